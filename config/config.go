@@ -1,9 +1,16 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
 	"github.com/joho/godotenv"
+	"github.com/wb-go/wbf/retry"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,9 +19,92 @@ type Config struct {
 	SlaveDSNs []string
 	RabbitURL string
 	RedisAddr string
+
+	TelegramBotToken string
+	TelegramAPIURL   string
+
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPSubject  string
+	SMTPStartTLS bool
+
+	WebhookSecret  string
+	WebhookTimeout time.Duration
+	// WebhookAllowPrivate разрешает webhook на loopback, частные и link-local адреса.
+	WebhookAllowPrivate bool
+
+	// SchedulerMode выбирает, кто ждёт наступления scheduled_at:
+	// db — воркер опрашивает Postgres и публикует только наступившие уведомления,
+	// broker — сообщение публикуется сразу и ждёт срока в очередях-бакетах с TTL,
+	// timer — сообщение публикуется сразу, воркер держит его до срока в памяти.
+	SchedulerMode     string
+	SchedulerInterval time.Duration
+	SchedulerBatch    int
+
+	// QueueTTLGrace — сколько сообщение может пролежать в очереди после scheduled_at,
+	// прежде чем RabbitMQ его удалит, а сверка обработает уведомление по ReconcilePolicy.
+	QueueTTLGrace     time.Duration
+	LostCheckInterval time.Duration
+	// ReconcilePolicy — что сверка делает с просроченными уведомлениями:
+	// requeue, fail (пометить Lost) или alert (только сообщить).
+	ReconcilePolicy string
+
+	IdempotencyRetention time.Duration
+
+	// DeliveryLease — на сколько воркер захватывает сообщение перед отправкой;
+	// должно превышать время одной попытки доставки.
+	DeliveryLease time.Duration
+
+	// RetryPolicies — встроенные политики повторов, дополненные RETRY_POLICIES,
+	// и их назначение каналам из CHANNEL_RETRY_POLICIES.
+	RetryPolicies domain.RetryPolicies
+
+	// WorkerConcurrency — обработчики доставки для каналов без своего лимита,
+	// ChannelConcurrency — отдельные пулы каналов из CHANNEL_CONCURRENCY.
+	WorkerConcurrency  int
+	ChannelConcurrency map[string]int
+	// WorkerPrefetch — сколько неподтверждённых сообщений брокер отдаёт воркеру;
+	// по умолчанию — общее число обработчиков, а в режиме timer ещё и TimerCapacity.
+	WorkerPrefetch int
+	// TimerCapacity — сколько ненаступивших сообщений воркер держит в памяти в режиме
+	// timer сверх обработчиков: ожидание срока не занимает пул.
+	TimerCapacity int
+	// MetricsAddr — адрес /debug/vars воркера; пусто — не слушать.
+	MetricsAddr string
+	// AdminAddr — отдельный адрес admin‑эндпоинтов воркера. Они и admin‑эндпоинты DLQ
+	// в API требуют AdminToken, а без него недоступны.
+	AdminAddr  string
+	AdminToken string
+	// ShutdownTimeout — сколько воркер при остановке ждёт начатые доставки,
+	// прежде чем прервать их и вернуть сообщения к доставке.
+	ShutdownTimeout time.Duration
 }
 
-const DefaultHTTPPort = ":8080"
+const (
+	DefaultHTTPPort       = ":8080"
+	DefaultWebhookTimeout = 10 * time.Second
+
+	SchedulerModeDB     = "db"
+	SchedulerModeBroker = "broker"
+	SchedulerModeTimer  = "timer"
+
+	DefaultSchedulerInterval = time.Second
+	DefaultSchedulerBatch    = 100
+
+	DefaultQueueTTLGrace     = time.Hour
+	DefaultLostCheckInterval = time.Minute
+
+	DefaultIdempotencyRetention = 24 * time.Hour
+	DefaultDeliveryLease        = 5 * time.Minute
+
+	DefaultWorkerConcurrency = 10
+	DefaultTimerCapacity     = 1000
+	DefaultMetricsAddr       = ":9090"
+	DefaultAdminAddr         = "127.0.0.1:9091"
+	DefaultShutdownTimeout   = 30 * time.Second
+)
 
 func NewConfig() (*Config, error) {
 	cfg := Config{}
@@ -56,5 +146,268 @@ func NewConfig() (*Config, error) {
 		cfg.RedisAddr = "localhost:6379"
 	}
 
+	cfg.TelegramBotToken = os.Getenv("TELEGRAM_BOT_TOKEN")
+	if cfg.TelegramBotToken == "" {
+		log.Print("No Telegram bot token found")
+	}
+	cfg.TelegramAPIURL = os.Getenv("TELEGRAM_API_URL")
+
+	cfg.SMTPAddr = os.Getenv("SMTP_ADDR")
+	cfg.SMTPUsername = os.Getenv("SMTP_USERNAME")
+	cfg.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	cfg.SMTPFrom = os.Getenv("SMTP_FROM")
+	cfg.SMTPSubject = os.Getenv("SMTP_SUBJECT")
+	cfg.SMTPStartTLS = os.Getenv("SMTP_STARTTLS") == "true"
+
+	cfg.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+	if cfg.WebhookSecret == "" {
+		log.Print("No webhook secret found, webhook signatures will use an empty key")
+	}
+	cfg.WebhookTimeout = DefaultWebhookTimeout
+	if v := os.Getenv("WEBHOOK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT: %w", err)
+		}
+		cfg.WebhookTimeout = d
+	}
+	cfg.WebhookAllowPrivate = os.Getenv("WEBHOOK_ALLOW_PRIVATE") == "true"
+
+	cfg.SchedulerMode = os.Getenv("SCHEDULER_MODE")
+	switch cfg.SchedulerMode {
+	case "":
+		cfg.SchedulerMode = SchedulerModeDB
+	case SchedulerModeDB, SchedulerModeBroker, SchedulerModeTimer:
+	default:
+		return nil, fmt.Errorf("invalid SCHEDULER_MODE %q", cfg.SchedulerMode)
+	}
+	cfg.SchedulerInterval = DefaultSchedulerInterval
+	if v := os.Getenv("SCHEDULER_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SCHEDULER_INTERVAL %q", v)
+		}
+		cfg.SchedulerInterval = d
+	}
+	cfg.SchedulerBatch = DefaultSchedulerBatch
+	if v := os.Getenv("SCHEDULER_BATCH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid SCHEDULER_BATCH %q", v)
+		}
+		cfg.SchedulerBatch = n
+	}
+
+	cfg.QueueTTLGrace = DefaultQueueTTLGrace
+	if v := os.Getenv("QUEUE_TTL_GRACE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid QUEUE_TTL_GRACE %q", v)
+		}
+		cfg.QueueTTLGrace = d
+	}
+	cfg.LostCheckInterval = DefaultLostCheckInterval
+	if v := os.Getenv("LOST_CHECK_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid LOST_CHECK_INTERVAL %q", v)
+		}
+		cfg.LostCheckInterval = d
+	}
+
+	cfg.ReconcilePolicy = os.Getenv("RECONCILE_POLICY")
+	if cfg.ReconcilePolicy == "" {
+		cfg.ReconcilePolicy = domain.ReconcileFail
+	}
+	if !domain.IsReconcilePolicy(cfg.ReconcilePolicy) {
+		return nil, fmt.Errorf("invalid RECONCILE_POLICY %q", cfg.ReconcilePolicy)
+	}
+
+	cfg.IdempotencyRetention = DefaultIdempotencyRetention
+	if v := os.Getenv("IDEMPOTENCY_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid IDEMPOTENCY_RETENTION %q", v)
+		}
+		cfg.IdempotencyRetention = d
+	}
+
+	cfg.DeliveryLease = DefaultDeliveryLease
+	if v := os.Getenv("DELIVERY_LEASE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid DELIVERY_LEASE %q", v)
+		}
+		cfg.DeliveryLease = d
+	}
+
+	policies, err := parseRetryPolicies(os.Getenv("RETRY_POLICIES"), os.Getenv("CHANNEL_RETRY_POLICIES"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.RetryPolicies = policies
+
+	cfg.WorkerConcurrency = DefaultWorkerConcurrency
+	if v := os.Getenv("WORKER_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WORKER_CONCURRENCY %q", v)
+		}
+		cfg.WorkerConcurrency = n
+	}
+
+	channels, err := parseChannelConcurrency(os.Getenv("CHANNEL_CONCURRENCY"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.ChannelConcurrency = channels
+
+	cfg.TimerCapacity = DefaultTimerCapacity
+	if v := os.Getenv("TIMER_CAPACITY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid TIMER_CAPACITY %q", v)
+		}
+		cfg.TimerCapacity = n
+	}
+
+	cfg.WorkerPrefetch = cfg.WorkerConcurrency
+	for _, n := range channels {
+		cfg.WorkerPrefetch += n
+	}
+	if cfg.SchedulerMode == SchedulerModeTimer {
+		cfg.WorkerPrefetch += cfg.TimerCapacity
+	}
+	if v := os.Getenv("WORKER_PREFETCH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid WORKER_PREFETCH %q", v)
+		}
+		cfg.WorkerPrefetch = n
+	}
+
+	cfg.MetricsAddr = DefaultMetricsAddr
+	if v, ok := os.LookupEnv("METRICS_ADDR"); ok {
+		cfg.MetricsAddr = v
+	}
+
+	cfg.AdminAddr = DefaultAdminAddr
+	if v := os.Getenv("ADMIN_ADDR"); v != "" {
+		cfg.AdminAddr = v
+	}
+	cfg.AdminToken = os.Getenv("ADMIN_TOKEN")
+
+	cfg.ShutdownTimeout = DefaultShutdownTimeout
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid SHUTDOWN_TIMEOUT %q", v)
+		}
+		cfg.ShutdownTimeout = d
+	}
+
 	return &cfg, nil
 }
+
+// RetryStrategy переводит политику name в стратегию повторов wbf для Postgres и RabbitMQ.
+func (c *Config) RetryStrategy(name string) retry.Strategy {
+	p := c.RetryPolicies.Policies[name]
+	return retry.Strategy{
+		Attempts: p.MaxAttempts,
+		Delay:    p.BaseDelay,
+		Backoff:  p.Multiplier,
+	}
+}
+
+// retryPolicyJSON — политика в RETRY_POLICIES; длительности в формате time.ParseDuration.
+type retryPolicyJSON struct {
+	MaxAttempts int      `json:"max_attempts"`
+	BaseDelay   string   `json:"base_delay"`
+	Multiplier  float64  `json:"multiplier"`
+	MaxDelay    string   `json:"max_delay"`
+	Delays      []string `json:"delays"`
+	Jitter      float64  `json:"jitter"`
+	MaxAge      string   `json:"max_age"`
+}
+
+// parseRetryPolicies разбирает RETRY_POLICIES, например
+// {"patient":{"max_attempts":8,"base_delay":"1m","multiplier":2,"max_delay":"1h","jitter":0.2,"max_age":"48h"}},
+// и CHANNEL_RETRY_POLICIES вида "email=patient,webhook=default".
+func parseRetryPolicies(policiesJSON, channels string) (domain.RetryPolicies, error) {
+	policies := domain.DefaultRetryPolicies()
+
+	if policiesJSON != "" {
+		var raw map[string]retryPolicyJSON
+		if err := json.Unmarshal([]byte(policiesJSON), &raw); err != nil {
+			return policies, fmt.Errorf("invalid RETRY_POLICIES: %w", err)
+		}
+		for name, r := range raw {
+			p := domain.RetryPolicy{MaxAttempts: r.MaxAttempts, Multiplier: r.Multiplier, Jitter: r.Jitter}
+			var err error
+			if p.BaseDelay, err = parseOptionalDuration(r.BaseDelay); err != nil {
+				return policies, fmt.Errorf("invalid RETRY_POLICIES %q base_delay: %w", name, err)
+			}
+			if p.MaxDelay, err = parseOptionalDuration(r.MaxDelay); err != nil {
+				return policies, fmt.Errorf("invalid RETRY_POLICIES %q max_delay: %w", name, err)
+			}
+			if p.MaxAge, err = parseOptionalDuration(r.MaxAge); err != nil {
+				return policies, fmt.Errorf("invalid RETRY_POLICIES %q max_age: %w", name, err)
+			}
+			for _, v := range r.Delays {
+				d, err := time.ParseDuration(v)
+				if err != nil || d < 0 {
+					return policies, fmt.Errorf("invalid RETRY_POLICIES %q delays: %q", name, v)
+				}
+				p.Delays = append(p.Delays, d)
+			}
+			if p.MaxAttempts < 1 || p.Multiplier < 0 || p.Jitter < 0 || p.Jitter > 1 {
+				return policies, fmt.Errorf("invalid RETRY_POLICIES %q: max_attempts must be positive, jitter within [0, 1]", name)
+			}
+			// стратегия wbf для Postgres и RabbitMQ знает только число попыток, задержку
+			// и множитель — остальные поля молча не действовали бы
+			infra := name == domain.PostgresRetryPolicy || name == domain.RabbitMQRetryPolicy
+			if infra && (len(p.Delays) > 0 || p.MaxDelay > 0 || p.Jitter > 0 || p.MaxAge > 0) {
+				return policies, fmt.Errorf("invalid RETRY_POLICIES %q: only max_attempts, base_delay and multiplier are supported", name)
+			}
+			policies.Policies[name] = p
+		}
+	}
+
+	for _, pair := range strings.Split(channels, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		channel, name, ok := strings.Cut(pair, "=")
+		channel, name = strings.TrimSpace(channel), strings.TrimSpace(name)
+		if !ok || !domain.IsKnownChannel(channel) || !policies.Has(name) {
+			return policies, fmt.Errorf("invalid CHANNEL_RETRY_POLICIES entry %q", pair)
+		}
+		policies.Channels[channel] = name
+	}
+	return policies, nil
+}
+
+// parseChannelConcurrency разбирает CHANNEL_CONCURRENCY вида "email=2,webhook=5".
+func parseChannelConcurrency(v string) (map[string]int, error) {
+	res := map[string]int{}
+	for _, pair := range strings.Split(v, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		channel, limit, ok := strings.Cut(pair, "=")
+		channel = strings.TrimSpace(channel)
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if !ok || !domain.IsKnownChannel(channel) || err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid CHANNEL_CONCURRENCY entry %q", pair)
+		}
+		res[channel] = n
+	}
+	return res, nil
+}
+
+func parseOptionalDuration(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(v)
+}
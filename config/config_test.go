@@ -0,0 +1,85 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+func TestParseRetryPolicies(t *testing.T) {
+	policies, err := parseRetryPolicies(
+		`{"patient":{"max_attempts":8,"base_delay":"1m","multiplier":2,"max_delay":"1h","jitter":0.2,"max_age":"48h"},
+		  "steps":{"max_attempts":3,"delays":["5s","1m"]}}`,
+		"email=patient, webhook=default",
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := domain.RetryPolicy{MaxAttempts: 8, BaseDelay: time.Minute, Multiplier: 2, MaxDelay: time.Hour, Jitter: 0.2, MaxAge: 48 * time.Hour}
+	if got := policies.Policies["patient"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected policy %+v", got)
+	}
+	if got := policies.Policies["steps"].Delays; !reflect.DeepEqual(got, []time.Duration{5 * time.Second, time.Minute}) {
+		t.Fatalf("unexpected delays %v", got)
+	}
+	if !policies.Has(domain.DefaultRetryPolicy) || !policies.Has(domain.PostgresRetryPolicy) {
+		t.Fatalf("expected built-in policies to be kept")
+	}
+	if policies.Channels[domain.ChannelEmail] != "patient" || policies.Channels[domain.ChannelWebhook] != domain.DefaultRetryPolicy {
+		t.Fatalf("unexpected channel policies %v", policies.Channels)
+	}
+}
+
+func TestParseRetryPolicies_Invalid(t *testing.T) {
+	cases := []struct{ policies, channels string }{
+		{`{"p":{"max_attempts":0}}`, ""},
+		{`{"p":{"max_attempts":3,"base_delay":"soon"}}`, ""},
+		{`{"p":{"max_attempts":3,"delays":["10s","later"]}}`, ""},
+		{"", "email=unknown"},
+		{"", "sms=default"},
+	}
+	for _, c := range cases {
+		if _, err := parseRetryPolicies(c.policies, c.channels); err == nil {
+			t.Fatalf("expected error for %q %q", c.policies, c.channels)
+		}
+	}
+}
+
+func TestParseRetryPolicies_InfrastructureFields(t *testing.T) {
+	policies, err := parseRetryPolicies(`{"postgres":{"max_attempts":5,"base_delay":"200ms","multiplier":3}}`, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cfg := Config{RetryPolicies: policies}
+	if got := cfg.RetryStrategy(domain.PostgresRetryPolicy); got.Attempts != 5 || got.Delay != 200*time.Millisecond || got.Backoff != 3 {
+		t.Fatalf("unexpected postgres strategy %+v", got)
+	}
+
+	for _, v := range []string{
+		`{"postgres":{"max_attempts":3,"delays":["5s"]}}`,
+		`{"rabbitmq":{"max_attempts":3,"base_delay":"1s","max_delay":"10s"}}`,
+		`{"rabbitmq":{"max_attempts":3,"base_delay":"1s","jitter":0.1}}`,
+		`{"postgres":{"max_attempts":3,"base_delay":"1s","max_age":"1m"}}`,
+	} {
+		if _, err := parseRetryPolicies(v, ""); err == nil {
+			t.Fatalf("expected unsupported field to be rejected in %s", v)
+		}
+	}
+}
+
+func TestParseChannelConcurrency(t *testing.T) {
+	limits, err := parseChannelConcurrency("email=2, webhook=5")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(limits) != 2 || limits[domain.ChannelEmail] != 2 || limits[domain.ChannelWebhook] != 5 {
+		t.Fatalf("unexpected limits %v", limits)
+	}
+	for _, v := range []string{"email=0", "sms=1", "email"} {
+		if _, err := parseChannelConcurrency(v); err == nil {
+			t.Fatalf("expected error for %q", v)
+		}
+	}
+}
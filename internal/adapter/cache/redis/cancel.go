@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const cancelChannel = "notifications:cancelled"
+
+// CancelBus рассылает отмены через Redis pub/sub. Pub/sub не хранит сообщения:
+// воркер, не подписанный в момент отмены, узнает о ней при захвате сообщения.
+type CancelBus struct {
+	client *redis.Client
+}
+
+func NewCancelBus(addr string) *CancelBus {
+	return &CancelBus{
+		client: redis.NewClient(&redis.Options{
+			Addr: addr,
+		}),
+	}
+}
+
+func (b *CancelBus) PublishCancel(ctx context.Context, id string) error {
+	return b.client.Publish(ctx, cancelChannel, id).Err()
+}
+
+func (b *CancelBus) SubscribeCancel(ctx context.Context) (<-chan string, error) {
+	sub := b.client.Subscribe(ctx, cancelChannel)
+	// дожидаемся подтверждения подписки, чтобы не потерять отмены сразу после старта
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+
+	ids := make(chan string)
+	go func() {
+		defer close(ids)
+		defer sub.Close()
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-msgs:
+				if !ok {
+					return
+				}
+				select {
+				case ids <- m.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ids, nil
+}
@@ -0,0 +1,29 @@
+package rabbitmq
+
+import (
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// DeadLetterQueueName — очередь сообщений, которые не удалось доставить.
+	// Воркер сохраняет каждое с причиной, а администратор может вернуть его в доставку.
+	DeadLetterQueueName = "notifications.dlq"
+
+	// DeadLetterReasonHeader и DeadLetterErrorHeader — причина и текст ошибки,
+	// с которыми воркер сам кладёт сообщение в DLQ. У сообщений, переложенных
+	// брокером, причина в x-first-death-reason.
+	DeadLetterReasonHeader = "x-dlq-reason"
+	DeadLetterErrorHeader  = "x-dlq-error"
+)
+
+// MainQueueArgs — аргументы notifications.queue: отклонённые без requeue и истёкшие
+// по TTL сообщения брокер перекладывает в DLQ через exchange по умолчанию, а
+// x-max-priority делает её приоритетной — срочные сообщения отдаются воркерам первыми.
+func MainQueueArgs() amqp091.Table {
+	return amqp091.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": DeadLetterQueueName,
+		"x-max-priority":            int32(domain.MaxPriorityLevel),
+	}
+}
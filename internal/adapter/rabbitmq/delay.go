@@ -0,0 +1,56 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// DelayBuckets — TTL очередей ожидания для SCHEDULER_MODE=broker, по возрастанию.
+// Сообщение кладётся в наибольший бакет, не превышающий оставшееся ожидание; по истечении
+// TTL брокер возвращает его через dead-letter в notifications.exchange, и воркер
+// перекладывает его в следующий бакет, пока срок не наступит.
+var DelayBuckets = []time.Duration{
+	time.Second,
+	10 * time.Second,
+	time.Minute,
+	10 * time.Minute,
+	time.Hour,
+}
+
+// DelayQueueName возвращает имя очереди бакета; оно же служит ключом маршрутизации.
+func DelayQueueName(bucket time.Duration) string {
+	switch {
+	case bucket%time.Hour == 0:
+		return fmt.Sprintf("notifications.delay.%dh", bucket/time.Hour)
+	case bucket%time.Minute == 0:
+		return fmt.Sprintf("notifications.delay.%dm", bucket/time.Minute)
+	}
+	return fmt.Sprintf("notifications.delay.%ds", bucket/time.Second)
+}
+
+// DelayQueueArgs — аргументы очереди бакета. Продьюсер и consumer объявляют
+// очереди с одинаковыми аргументами, иначе RabbitMQ отклонит повторное объявление.
+func DelayQueueArgs(bucket time.Duration) amqp091.Table {
+	return amqp091.Table{
+		"x-message-ttl":             bucket.Milliseconds(),
+		"x-dead-letter-exchange":    defaultExchangeName,
+		"x-dead-letter-routing-key": defaultRoutingKeyName,
+	}
+}
+
+// DelayBucket выбирает бакет для оставшегося ожидания. Ожидание короче наименьшего
+// бакета округляется до него вверх. ok == false — срок наступил, ждать не нужно.
+func DelayBucket(remaining time.Duration) (bucket time.Duration, ok bool) {
+	if remaining <= 0 {
+		return 0, false
+	}
+	bucket = DelayBuckets[0]
+	for _, b := range DelayBuckets {
+		if b <= remaining {
+			bucket = b
+		}
+	}
+	return bucket, true
+}
@@ -0,0 +1,36 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayBucket(t *testing.T) {
+	cases := []struct {
+		remaining time.Duration
+		want      time.Duration
+		ok        bool
+	}{
+		{-time.Second, 0, false},
+		{0, 0, false},
+		{300 * time.Millisecond, time.Second, true},
+		{45 * time.Second, 10 * time.Second, true},
+		{time.Minute, time.Minute, true},
+		{7 * 24 * time.Hour, time.Hour, true},
+	}
+	for _, tc := range cases {
+		got, ok := DelayBucket(tc.remaining)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("%s: expected (%s, %v), got (%s, %v)", tc.remaining, tc.want, tc.ok, got, ok)
+		}
+	}
+}
+
+func TestDelayQueueName(t *testing.T) {
+	want := []string{"notifications.delay.1s", "notifications.delay.10s", "notifications.delay.1m", "notifications.delay.10m", "notifications.delay.1h"}
+	for i, b := range DelayBuckets {
+		if got := DelayQueueName(b); got != want[i] {
+			t.Fatalf("expected %q, got %q", want[i], got)
+		}
+	}
+}
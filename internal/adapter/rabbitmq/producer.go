@@ -3,7 +3,10 @@ package rabbitmq
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/dontpanicw/DelayedNotifier/internal/domain"
@@ -16,21 +19,37 @@ import (
 const (
 	defaultExchangeName   = "notifications.exchange"
 	defaultRoutingKeyName = "notifications.create"
+	defaultQueueName      = "notifications.queue"
 )
 
 var _ port.MessageQueue = (*MessageQueueProducer)(nil)
 
+// ErrPublishNacked — брокер не принял сообщение (nack в режиме publisher confirms).
+var ErrPublishNacked = errors.New("rabbitmq: publish was nacked by broker")
+
+// ErrPublishUnroutable — брокер вернул сообщение (mandatory): ни одна очередь к ключу не привязана.
+var ErrPublishUnroutable = errors.New("rabbitmq: publish was returned as unroutable")
+
 type MessageQueueProducer struct {
 	Client   *rabbitmq.RabbitClient
 	Exchange string
+	// TTLGrace — запас времени после scheduled_at, в течение которого сообщение живёт в очереди.
+	TTLGrace time.Duration
+	// DelayBuckets — публиковать недождавшиеся сообщения в очереди ожидания (SCHEDULER_MODE=broker).
+	DelayBuckets bool
+
+	strategy retry.Strategy
+
+	// confirmMu сериализует публикации: в канале ждёт подтверждения одна публикация,
+	// поэтому return и ack канала относятся к ней.
+	confirmMu sync.Mutex
+	// confirmCh — канал в режиме confirm, общий для публикаций; после разрыва соединения
+	// открывается заново.
+	confirmCh *amqp091.Channel
+	returns   chan amqp091.Return
 }
 
-func NewMessageQueueProducer(rabbitURL string) (*MessageQueueProducer, error) {
-	strategy := retry.Strategy{
-		Attempts: 3,
-		Delay:    3 * time.Second,
-		Backoff:  2,
-	}
+func NewMessageQueueProducer(rabbitURL string, ttlGrace time.Duration, delayBuckets bool, strategy retry.Strategy) (*MessageQueueProducer, error) {
 	cfg := rabbitmq.ClientConfig{
 		URL:            rabbitURL,
 		ConnectionName: "delayed_notifier",
@@ -46,7 +65,25 @@ func NewMessageQueueProducer(rabbitURL string) (*MessageQueueProducer, error) {
 		return nil, err
 	}
 
-	err = client.DeclareExchange(
+	mp := &MessageQueueProducer{
+		Client:       client,
+		Exchange:     defaultExchangeName,
+		TTLGrace:     ttlGrace,
+		DelayBuckets: delayBuckets,
+		strategy:     strategy,
+	}
+	if err := mp.declareTopology(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return mp, nil
+}
+
+// declareTopology объявляет exchange, DLQ и notifications.queue с привязкой, а в режиме
+// broker — очереди ожидания. Без этого публикация до первого старта воркера уходит в никуда.
+// Аргументы очередей совпадают с объявлением воркера, иначе RabbitMQ отклонит повторное.
+func (mp *MessageQueueProducer) declareTopology() error {
+	err := mp.Client.DeclareExchange(
 		defaultExchangeName,
 		"direct", // простой direct‑exchange
 		true,     // durable
@@ -54,34 +91,64 @@ func NewMessageQueueProducer(rabbitURL string) (*MessageQueueProducer, error) {
 		false,    // internal
 		nil,      // no extra args
 	)
+	if err != nil {
+		return err
+	}
 
+	ch, err := mp.Client.GetChannel()
 	if err != nil {
-		client.Close()
-		return nil, err
+		return err
+	}
+	defer func() { _ = ch.Close() }()
+	if _, err := ch.QueueDeclare(DeadLetterQueueName, true, false, false, false, nil); err != nil {
+		return err
 	}
 
-	return &MessageQueueProducer{
-		Client:   client,
-		Exchange: defaultExchangeName,
-	}, nil
+	if err := mp.Client.DeclareQueue(defaultQueueName, defaultExchangeName, defaultRoutingKeyName, true, false, true, MainQueueArgs()); err != nil {
+		return err
+	}
 
+	if mp.DelayBuckets {
+		return declareDelayQueues(mp.Client)
+	}
+	return nil
 }
 
+// SendMessage публикует сообщение и ждёт подтверждения брокера (publisher confirms):
+// nil означает, что RabbitMQ сохранил сообщение в очереди, и relay outbox может пометить
+// его отправленным. Возвращённое как немаршрутизируемое сообщение публикуется повторно
+// после того, как топология объявлена заново.
 func (mp *MessageQueueProducer) SendMessage(ctx context.Context, message domain.Message) error {
-	publisher := rabbitmq.NewPublisher(mp.Client, mp.Exchange, "application/json")
-
 	bodyMsg, err := json.Marshal(message)
 	if err != nil {
 		return err
 	}
 	routingKey := defaultRoutingKeyName
-	err = publisher.Publish(
-		ctx,
-		bodyMsg,
-		routingKey,
-		rabbitmq.WithExpiration(5*time.Minute),
-		rabbitmq.WithHeaders(amqp091.Table{"x-service": "auth"}),
-	)
+	if mp.DelayBuckets {
+		if bucket, ok := DelayBucket(time.Until(message.DueAt())); ok {
+			routingKey = DelayQueueName(bucket)
+		}
+	}
+	priority, _ := domain.PriorityLevel(message.Priority)
+	pub := amqp091.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp091.Persistent,
+		Priority:     priority,
+		Body:         bodyMsg,
+	}
+	rabbitmq.WithExpiration(messageTTL(message, time.Now(), mp.TTLGrace))(&pub)
+	rabbitmq.WithHeaders(amqp091.Table{"x-service": "auth"})(&pub)
+
+	err = retry.DoContext(ctx, mp.strategy, func() error {
+		err := mp.publishConfirmed(ctx, routingKey, pub)
+		if errors.Is(err, ErrPublishUnroutable) {
+			// очередь могли удалить (например, брокер перезапущен без её сохранения)
+			if declareErr := mp.declareTopology(); declareErr != nil {
+				log.Printf("failed to redeclare RabbitMQ topology: %v", declareErr)
+			}
+		}
+		return err
+	})
 	if err != nil {
 		log.Printf("publish to RabbitMQ failed: %v", err)
 		return err
@@ -89,7 +156,99 @@ func (mp *MessageQueueProducer) SendMessage(ctx context.Context, message domain.
 	return nil
 }
 
+// publishConfirmed публикует с флагом mandatory в канале в режиме confirm и ждёт ack брокера.
+func (mp *MessageQueueProducer) publishConfirmed(ctx context.Context, routingKey string, pub amqp091.Publishing) error {
+	mp.confirmMu.Lock()
+	defer mp.confirmMu.Unlock()
+
+	ch, err := mp.confirmChannel()
+	if err != nil {
+		return err
+	}
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, mp.Exchange, routingKey, true, false, pub)
+	if err != nil {
+		mp.resetConfirmChannel()
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		// ack и return этой публикации ещё могут прийти: следующая их не должна увидеть
+		mp.resetConfirmChannel()
+		return err
+	}
+	return ConfirmResult(acked, mp.returns)
+}
+
+// confirmChannel возвращает канал публикаций, открывая его при первом обращении
+// и после закрытия (разрыв соединения, ошибка канала). Вызывается под confirmMu.
+func (mp *MessageQueueProducer) confirmChannel() (*amqp091.Channel, error) {
+	if mp.confirmCh != nil && !mp.confirmCh.IsClosed() {
+		return mp.confirmCh, nil
+	}
+	ch, err := mp.Client.GetChannel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	mp.confirmCh = ch
+	// буфер на одно сообщение: amqp091 отдаёт return слушателю синхронно, до ack
+	mp.returns = ch.NotifyReturn(make(chan amqp091.Return, 1))
+	return ch, nil
+}
+
+// resetConfirmChannel закрывает канал публикаций; следующая откроет новый.
+// Вызывается под confirmMu.
+func (mp *MessageQueueProducer) resetConfirmChannel() {
+	if mp.confirmCh != nil {
+		_ = mp.confirmCh.Close()
+		mp.confirmCh = nil
+	}
+}
+
+// ConfirmResult разбирает подтверждение публикации; им пользуется и воркер. Немаршрутизируемое
+// сообщение брокер тоже подтверждает (ack), но перед этим возвращает его через basic.return.
+func ConfirmResult(acked bool, returns <-chan amqp091.Return) error {
+	if !acked {
+		return ErrPublishNacked
+	}
+	select {
+	case r, ok := <-returns:
+		if ok {
+			return fmt.Errorf("%w: %s %d %s", ErrPublishUnroutable, r.RoutingKey, r.ReplyCode, r.ReplyText)
+		}
+	default:
+	}
+	return nil
+}
+
+// declareDelayQueues объявляет очереди бакетов и привязывает их к exchange по имени очереди.
+func declareDelayQueues(client *rabbitmq.RabbitClient) error {
+	for _, bucket := range DelayBuckets {
+		name := DelayQueueName(bucket)
+		if err := client.DeclareQueue(name, defaultExchangeName, name, true, false, true, DelayQueueArgs(bucket)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageTTL выводит время жизни сообщения в очереди из расписания: до срока (или повтора)
+// плюс grace на простой или отставание воркеров. Истёкшие сообщения находит детектор Lost.
+func messageTTL(message domain.Message, now time.Time, grace time.Duration) time.Duration {
+	ttl := grace
+	if wait := message.DueAt().Sub(now); wait > 0 {
+		ttl += wait
+	}
+	return ttl
+}
+
 func (mp *MessageQueueProducer) Close() {
+	mp.confirmMu.Lock()
+	mp.resetConfirmChannel()
+	mp.confirmMu.Unlock()
 	if mp.Client != nil {
 		mp.Client.Close()
 	}
@@ -0,0 +1,40 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestMessageTTL(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	week := domain.Message{ScheduledAt: now.Add(7 * 24 * time.Hour)}
+	if got := messageTTL(week, now, time.Hour); got != 7*24*time.Hour+time.Hour {
+		t.Fatalf("expected TTL to cover the whole delay plus grace, got %s", got)
+	}
+
+	due := domain.Message{ScheduledAt: now.Add(-time.Minute)}
+	if got := messageTTL(due, now, time.Hour); got != time.Hour {
+		t.Fatalf("expected grace only for a due message, got %s", got)
+	}
+}
+
+func TestConfirmResult(t *testing.T) {
+	if err := ConfirmResult(true, make(chan amqp091.Return, 1)); err != nil {
+		t.Fatalf("expected routed and acked publish to succeed, got %v", err)
+	}
+	if err := ConfirmResult(false, make(chan amqp091.Return, 1)); !errors.Is(err, ErrPublishNacked) {
+		t.Fatalf("expected ErrPublishNacked, got %v", err)
+	}
+
+	// немаршрутизируемое сообщение брокер возвращает, а потом всё равно подтверждает
+	returns := make(chan amqp091.Return, 1)
+	returns <- amqp091.Return{ReplyCode: 312, ReplyText: "NO_ROUTE", RoutingKey: defaultRoutingKeyName}
+	if err := ConfirmResult(true, returns); !errors.Is(err, ErrPublishUnroutable) {
+		t.Fatalf("expected ErrPublishUnroutable, got %v", err)
+	}
+}
@@ -2,9 +2,15 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/dontpanicw/DelayedNotifier/config"
 	"github.com/dontpanicw/DelayedNotifier/internal/domain"
 	"github.com/dontpanicw/DelayedNotifier/internal/port"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/wb-go/wbf/dbpg"
 	"github.com/wb-go/wbf/retry"
 	"time"
@@ -14,41 +20,209 @@ var (
 	_ port.Repository = (*MessageRepository)(nil)
 )
 
+// messageColumns — порядок колонок, который ожидает scanMessage.
+const messageColumns = `id, text, status, scheduled_at, user_id, telegram_chat_id, channel, email, timezone,
+	webhook_url, webhook_headers, webhook_body,
+	cron, rrule, repeat_until, max_occurrences, parent_id, occurrence,
+	idempotency_key, request_hash, revision, retry_policy, next_attempt_at, priority`
+
 const (
 	getMessageQuery = `
 		select status
 		from messages 
 		where id = $1
 		`
-	createMessageQuery = `INSERT INTO messages (id, text, status, scheduled_at, user_id, telegram_chat_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
+	getFullMessageQuery = `SELECT ` + messageColumns + ` FROM messages WHERE id = $1`
+	createMessageQuery  = `INSERT INTO messages (` + messageColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
 		`
-	deleteMessageQuery = `DELETE FROM messages 
-       WHERE id = $1
-       `
-	listMessagesQuery = `SELECT id, text, status, scheduled_at, user_id, telegram_chat_id FROM messages ORDER BY created_at DESC`
-	updateStatusQuery = `UPDATE messages SET status = $2, updated_at = NOW() WHERE id = $1`
+	listMessagesQuery = `SELECT ` + messageColumns + ` FROM messages ORDER BY created_at DESC`
+	// compare-and-swap: статус меняется, только если текущий допускает переход
+	updateStatusQuery = `UPDATE messages SET status = $2, updated_at = NOW() WHERE id = $1 AND status = ANY($3)`
+	// изменение ожидающего сообщения возвращает его в Scheduled: в режиме db планировщик
+	// опубликует его к новому сроку, в режимах с outbox — relay по новой записи outbox
+	updatePendingQuery = `UPDATE messages SET text = $2, scheduled_at = $3, timezone = $4,
+			telegram_chat_id = $5, email = $6, webhook_url = $7,
+			status = $8, revision = revision + 1, next_attempt_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = ANY($9)
+		RETURNING revision`
+	// отмена серии отменяет и её ещё не доставленные вхождения
+	cancelMessageQuery = `WITH target AS (
+			UPDATE messages SET status = $2, updated_at = NOW() WHERE id = $1 AND status = ANY($3) RETURNING id
+		), occurrences AS (
+			UPDATE messages SET status = $2, updated_at = NOW()
+			WHERE parent_id IN (SELECT id FROM target) AND status = ANY($3)
+			RETURNING id
+		)
+		SELECT id FROM target UNION ALL SELECT id FROM occurrences`
+	// SKIP LOCKED позволяет нескольким воркерам опрашивать таблицу, не разбирая одни и те же строки;
+	// срочные публикуются первыми, даже если за ними очередь из массовой рассылки
+	dueMessagesQuery = `SELECT ` + messageColumns + ` FROM messages
+		WHERE (status = $1 AND scheduled_at <= NOW()) OR (status = $2 AND next_attempt_at <= NOW())
+		ORDER BY CASE priority WHEN 'critical' THEN 0 WHEN 'high' THEN 1 WHEN 'bulk' THEN 3 ELSE 2 END, scheduled_at
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED`
+	// updated_at — момент публикации (Queued, Retrying) или создания (Scheduled в режимах с outbox),
+	// dispatched_at — публикации relay: TTL сообщения в очереди отсчитывается от самого позднего
+	// из них и срока (повтора). Сообщение с неопубликованной записью outbox ещё не в очереди,
+	// а ждёт relay (например, пока недоступен RabbitMQ), и потерянным не считается.
+	// $1 — статусы, $2 — grace в секундах
+	overdueCondition = `status = ANY($1)
+			AND GREATEST(COALESCE(next_attempt_at, scheduled_at), updated_at,
+				(SELECT MAX(o.dispatched_at) FROM outbox o WHERE o.message_id = messages.id))
+				< NOW() - make_interval(secs => $2)
+			AND NOT EXISTS (SELECT 1 FROM outbox o WHERE o.message_id = messages.id AND o.dispatched_at IS NULL)`
+	markLostQuery = `UPDATE messages SET status = $3, updated_at = NOW()
+		WHERE ` + overdueCondition + `
+		RETURNING ` + messageColumns
+	// новая ревизия отсекает копию, если она всё же найдётся в очереди; updated_at
+	// заново отсчитывает grace, так что до новой публикации сообщение не сверяется повторно
+	requeueOverdueQuery = `UPDATE messages SET status = $3, next_attempt_at = NULL, revision = revision + 1, updated_at = NOW()
+		WHERE ` + overdueCondition + `
+		RETURNING ` + messageColumns
+	requeueOverdueToOutboxQuery = `WITH requeued AS (` + requeueOverdueQuery + `),
+		queued AS (INSERT INTO outbox (message_id) SELECT id FROM requeued)
+		SELECT ` + messageColumns + ` FROM requeued`
+	listOverdueQuery = `SELECT ` + messageColumns + ` FROM messages
+		WHERE ` + overdueCondition + `
+		ORDER BY scheduled_at`
+
+	// просроченный ключ освобождается, чтобы его можно было использовать снова
+	releaseIdempotencyKeyQuery = `UPDATE messages SET idempotency_key = NULL
+		WHERE user_id = $1 AND idempotency_key = $2 AND created_at <= NOW() - make_interval(secs => $3)`
+	getByIdempotencyKeyQuery = `SELECT ` + messageColumns + ` FROM messages WHERE user_id = $1 AND idempotency_key = $2`
+
+	// захват возможен из ожидающих статусов или поверх истёкшего чужого захвата;
+	// захват устаревшей копии (опубликованной до изменения сообщения) не проходит
+	claimMessageQuery = `UPDATE messages SET status = $2, lease_until = NOW() + make_interval(secs => $3),
+			attempts = attempts + 1, next_attempt_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND revision = $5 AND (status = ANY($4) OR (status = $2 AND lease_until < NOW()))
+		RETURNING attempts`
+	// повтор публикует планировщик (режим db) или relay по записи outbox
+	scheduleRetryQuery = `UPDATE messages SET status = $2, next_attempt_at = $3, lease_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = $4`
+	releaseLeasesQuery = `UPDATE messages SET status = $1, lease_until = NULL, updated_at = NOW()
+		WHERE status = $2 AND lease_until < NOW()
+		RETURNING id`
+	releaseLeaseQuery = `UPDATE messages SET status = $2, lease_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = $3`
+	// в режимах с outbox освобождённое сообщение нужно опубликовать заново
+	releaseLeasesToOutboxQuery = `WITH released AS (` + releaseLeasesQuery + `)
+		INSERT INTO outbox (message_id) SELECT id FROM released`
+
+	// номер попытки сквозной: продолжается после requeue и возврата истёкшего захвата
+	insertAttemptQuery = `INSERT INTO delivery_attempts (message_id, attempt, channel, started_at, finished_at,
+			outcome, error_class, response_code, response_body, error)
+		SELECT $1, COALESCE(MAX(attempt), 0) + 1, $2, $3, $4, $5, $6, $7, $8, $9
+		FROM delivery_attempts WHERE message_id = $1
+		RETURNING attempt`
+	listAttemptsQuery = `SELECT message_id, attempt, channel, started_at, finished_at,
+			outcome, error_class, response_code, response_body, error
+		FROM delivery_attempts WHERE message_id = $1
+		ORDER BY attempt`
+
+	// сообщение могло быть удалено или id в теле испорчен: запись DLQ сохраняется без ссылки
+	insertDeadLetterQuery = `INSERT INTO dead_letters (message_id, reason, error, payload)
+		SELECT (SELECT id FROM messages WHERE id = $1), $2, $3, $4`
+	listDeadLettersQuery = `SELECT id, message_id, reason, error, '', created_at, replayed_at
+		FROM dead_letters
+		WHERE ($1 = '' OR reason = $1)
+			AND ($2::uuid IS NULL OR message_id = $2)
+			AND ($3::timestamptz IS NULL OR created_at >= $3)
+			AND ($4::timestamptz IS NULL OR created_at < $4)
+			AND ($5 OR replayed_at IS NULL)
+		ORDER BY id DESC
+		LIMIT $6`
+	getDeadLetterQuery = `SELECT id, message_id, reason, error, payload, created_at, replayed_at
+		FROM dead_letters WHERE id = $1`
+	lockDeadLetterQuery = `SELECT message_id, replayed_at FROM dead_letters WHERE id = $1 FOR UPDATE`
+	// повтор начинает доставку заново: счётчик попыток сброшен, срок не раньше текущего
+	// момента (от него отсчитывается max_age политики), устаревшие копии отсекает ревизия
+	replayMessageQuery = `UPDATE messages SET status = $2, attempts = 0, next_attempt_at = NULL, lease_until = NULL,
+			scheduled_at = GREATEST(scheduled_at, NOW()), revision = revision + 1, updated_at = NOW()
+		WHERE id = $1 AND status = ANY($3)`
+	// остальные записи того же сообщения тоже закрываются: повторять его дважды нельзя
+	markReplayedQuery = `UPDATE dead_letters SET replayed_at = NOW() WHERE message_id = $1 AND replayed_at IS NULL`
+
+	insertOutboxQuery  = `INSERT INTO outbox (message_id) VALUES ($1)`
+	pendingOutboxQuery = `SELECT id, message_id FROM outbox
+		WHERE dispatched_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+	dispatchOutboxQuery = `UPDATE outbox SET dispatched_at = NOW() WHERE id = $1`
 )
 
+// uniqueViolation — код ошибки PostgreSQL при нарушении уникальности.
+const uniqueViolation = "23505"
+
 type MessageRepository struct {
 	PostgresDB *dbpg.DB
+	// Outbox — вместе с каждым Scheduled-сообщением в той же транзакции пишется
+	// запись outbox, которую публикует relay воркера (режимы broker и timer).
+	Outbox bool
+	// IdempotencyRetention — сколько хранится ключ идемпотентности.
+	IdempotencyRetention time.Duration
+	// Retry — повторы записи при сбоях Postgres (политика domain.PostgresRetryPolicy).
+	Retry retry.Strategy
 }
 
-func NewMessageRepository(config *config.Config) *MessageRepository {
+func NewMessageRepository(cfg *config.Config) *MessageRepository {
 	opts := &dbpg.Options{MaxOpenConns: 10, MaxIdleConns: 5}
-	db, err := dbpg.New(config.MasterDSN, config.SlaveDSNs, opts)
+	db, err := dbpg.New(cfg.MasterDSN, cfg.SlaveDSNs, opts)
 	if err != nil {
 		panic(err)
 	}
 
 	return &MessageRepository{
-		PostgresDB: db,
+		PostgresDB:           db,
+		Outbox:               cfg.SchedulerMode != config.SchedulerModeDB,
+		IdempotencyRetention: cfg.IdempotencyRetention,
+		Retry:                cfg.RetryStrategy(domain.PostgresRetryPolicy),
 	}
 }
 
 func (m *MessageRepository) CreateMessage(ctx context.Context, message domain.Message) error {
-	_, err := m.PostgresDB.ExecWithRetry(ctx, createRetryStrategy(), createMessageQuery, message.Id, message.Text, message.Status, message.ScheduledAt, message.UserId, message.TelegramChatId)
+	return m.createMessages(ctx, message)
+}
+
+// CreateSeries сохраняет родителя серии и её первое вхождение в одной транзакции:
+// серия без вхождения никогда бы не сработала.
+func (m *MessageRepository) CreateSeries(ctx context.Context, parent, first domain.Message) error {
+	return m.createMessages(ctx, parent, first)
+}
+
+// createMessages вставляет сообщения в одной транзакции. Сообщение и его публикация
+// фиксируются атомарно: relay опубликует его, даже если RabbitMQ сейчас недоступен
+// или процесс упадёт сразу после коммита.
+func (m *MessageRepository) createMessages(ctx context.Context, messages ...domain.Message) error {
+	err := m.PostgresDB.WithTxWithRetry(ctx, m.Retry, func(tx *sql.Tx) error {
+		for _, message := range messages {
+			headers, err := marshalHeaders(message.WebhookHeaders)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, createMessageQuery,
+				message.Id, message.Text, message.Status, message.ScheduledAt, message.UserId, message.TelegramChatId, message.Channel, message.Email, message.Timezone,
+				message.WebhookURL, headers, nullJSON(message.WebhookBody),
+				message.Cron, message.RRule, message.RepeatUntil, message.MaxOccurrences, nullString(message.ParentId), message.Occurrence,
+				nullString(message.IdempotencyKey), message.RequestHash, message.Revision, message.RetryPolicy, message.NextAttemptAt, priority(message),
+			); err != nil {
+				return err
+			}
+			if m.Outbox && message.Status == domain.JobStatusScheduled {
+				if _, err := tx.ExecContext(ctx, insertOutboxQuery, message.Id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return domain.ErrMessageExists
+		}
 		return err
 	}
 	return nil
@@ -63,46 +237,545 @@ func (m *MessageRepository) GetMessageStatus(ctx context.Context, id string) (st
 	return messageStatus, nil
 }
 
+// GetMessage читает сообщение с мастера: воркеру нужно актуальное состояние, а не реплика.
+func (m *MessageRepository) GetMessage(ctx context.Context, id string) (domain.Message, error) {
+	msg, err := scanMessage(m.PostgresDB.Master.QueryRowContext(ctx, getFullMessageQuery, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Message{}, domain.ErrMessageNotFound
+	}
+	return msg, err
+}
+
+// GetMessageByIdempotencyKey ищет сообщение пользователя по ключу идемпотентности.
+// Ключи старше IdempotencyRetention освобождаются и не находятся.
+func (m *MessageRepository) GetMessageByIdempotencyKey(ctx context.Context, userID uint32, key string) (domain.Message, error) {
+	if _, err := m.PostgresDB.Master.ExecContext(ctx, releaseIdempotencyKeyQuery, userID, key, m.IdempotencyRetention.Seconds()); err != nil {
+		return domain.Message{}, err
+	}
+	msg, err := scanMessage(m.PostgresDB.Master.QueryRowContext(ctx, getByIdempotencyKeyQuery, userID, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Message{}, domain.ErrMessageNotFound
+	}
+	return msg, err
+}
+
 func (m *MessageRepository) ListMessages(ctx context.Context) ([]domain.Message, error) {
-	rows, err := m.PostgresDB.QueryContext(ctx, listMessagesQuery)
+	return queryMessages(m.PostgresDB.QueryContext(ctx, listMessagesQuery))
+}
+
+// UpdateMessageStatus переводит сообщение в status, если это допускает жизненный цикл.
+// Из двух конкурирующих переходов выигрывает первый, второй получает *domain.TransitionError.
+func (m *MessageRepository) UpdateMessageStatus(ctx context.Context, id, status string) error {
+	res, err := m.PostgresDB.ExecWithRetry(ctx, m.Retry, updateStatusQuery, id, status, pq.Array(domain.PreviousStatuses(status)))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return err
+	}
+	return m.transitionError(ctx, id, status)
+}
+
+// UpdatePendingMessage сохраняет изменённые текст, срок и получателя сообщения, если оно
+// ещё ожидает доставки, и возвращает новую ревизию. Иначе — ошибка с domain.ErrNotPending.
+func (m *MessageRepository) UpdatePendingMessage(ctx context.Context, message domain.Message) (int, error) {
+	var revision int
+	// без ретраев: sql.ErrNoRows означает, что сообщение уже не ожидает
+	err := m.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, updatePendingQuery, message.Id, message.Text, message.ScheduledAt, message.Timezone,
+			message.TelegramChatId, message.Email, message.WebhookURL,
+			domain.JobStatusScheduled, pq.Array(domain.PendingStatuses)).Scan(&revision)
+		if err != nil {
+			return err
+		}
+		if !m.Outbox {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, insertOutboxQuery, message.Id)
+		return err
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		return revision, err
+	}
+
+	current, err := m.currentStatus(ctx, message.Id)
+	if err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%w: message %s is %s", domain.ErrNotPending, message.Id, current)
+}
+
+// CancelMessage переводит сообщение в Cancelled и возвращает id всех отменённых строк.
+// Уже захваченное на отправку или доставленное сообщение не отменяется.
+func (m *MessageRepository) CancelMessage(ctx context.Context, id string) ([]string, error) {
+	rows, err := m.PostgresDB.Master.QueryContext(ctx, cancelMessageQuery, id, domain.JobStatusCancelled, pq.Array(domain.PreviousStatuses(domain.JobStatusCancelled)))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var messages []domain.Message
+	var ids []string
 	for rows.Next() {
-		var msg domain.Message
-		var userID, chatID int64
-		if err := rows.Scan(&msg.Id, &msg.Text, &msg.Status, &msg.ScheduledAt, &userID, &chatID); err != nil {
+		var cancelled string
+		if err := rows.Scan(&cancelled); err != nil {
 			return nil, err
 		}
-		msg.UserId = uint32(userID)
-		msg.TelegramChatId = uint32(chatID)
-		messages = append(messages, msg)
+		ids = append(ids, cancelled)
 	}
-	return messages, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, m.transitionError(ctx, id, domain.JobStatusCancelled)
+	}
+	return ids, nil
 }
 
-func (m *MessageRepository) DeleteMessage(ctx context.Context, id string) error {
-	_, err := m.PostgresDB.ExecWithRetry(ctx, createRetryStrategy(), deleteMessageQuery, id)
+// transitionError объясняет несработавший compare-and-swap: сообщения нет
+// или его текущий статус не допускает перехода в to.
+func (m *MessageRepository) transitionError(ctx context.Context, id, to string) error {
+	current, err := m.currentStatus(ctx, id)
 	if err != nil {
 		return err
 	}
-	return nil
+	return &domain.TransitionError{Id: id, From: current, To: to}
 }
 
-func (m *MessageRepository) UpdateMessageStatus(ctx context.Context, id, status string) error {
-	_, err := m.PostgresDB.ExecWithRetry(ctx, createRetryStrategy(), updateStatusQuery, id, status)
+// currentStatus читает статус с мастера после несработавшего условного обновления.
+func (m *MessageRepository) currentStatus(ctx context.Context, id string) (string, error) {
+	var current string
+	err := m.PostgresDB.Master.QueryRowContext(ctx, getMessageQuery, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", domain.ErrMessageNotFound
+	}
+	return current, err
+}
+
+// DispatchDueMessages в одной транзакции блокирует наступившие сообщения и повторы,
+// передаёт их в dispatch и помечает Queued (Retrying). Ошибка dispatch прерывает пачку:
+// уже переданные фиксируются, остальные дождутся следующего опроса.
+func (m *MessageRepository) DispatchDueMessages(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error) {
+	var dispatched int
+	var dispatchErr error
+	err := m.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		dispatched = 0
+		due, err := queryMessages(tx.QueryContext(ctx, dueMessagesQuery, domain.JobStatusScheduled, domain.JobStatusFailed, limit))
+		if err != nil {
+			return err
+		}
+		for _, msg := range due {
+			if dispatchErr = dispatch(ctx, msg); dispatchErr != nil {
+				break
+			}
+			if err := markPublished(ctx, tx, msg); err != nil {
+				return err
+			}
+			dispatched++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return dispatched, dispatchErr
+}
+
+// markPublished отмечает, что сообщение передано в очередь: наступившее — Queued,
+// повтор после ошибки — Retrying.
+func markPublished(ctx context.Context, tx *sql.Tx, msg domain.Message) error {
+	status := domain.JobStatusQueued
+	if msg.Status == domain.JobStatusFailed {
+		status = domain.JobStatusRetrying
+	}
+	_, err := tx.ExecContext(ctx, updateStatusQuery, msg.Id, status, pq.Array(domain.PreviousStatuses(status)))
+	return err
+}
+
+// DispatchOutbox передаёт в dispatch до limit неопубликованных сообщений из outbox
+// и помечает их записи отправленными. Как и DispatchDueMessages, ошибка dispatch
+// прерывает пачку, не откатывая уже подтверждённые брокером публикации.
+func (m *MessageRepository) DispatchOutbox(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error) {
+	var dispatched int
+	var dispatchErr error
+	err := m.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		dispatched = 0
+		rows, err := tx.QueryContext(ctx, pendingOutboxQuery, limit)
+		if err != nil {
+			return err
+		}
+		type entry struct {
+			id        int64
+			messageID string
+		}
+		var pending []entry
+		for rows.Next() {
+			var e entry
+			if err := rows.Scan(&e.id, &e.messageID); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			pending = append(pending, e)
+		}
+		_ = rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, e := range pending {
+			msg, err := scanMessage(tx.QueryRowContext(ctx, getFullMessageQuery, e.messageID))
+			if err != nil {
+				return err
+			}
+			if dispatchErr = dispatch(ctx, msg); dispatchErr != nil {
+				break
+			}
+			if _, err := tx.ExecContext(ctx, dispatchOutboxQuery, e.id); err != nil {
+				return err
+			}
+			if msg.Status == domain.JobStatusFailed {
+				if err := markPublished(ctx, tx, msg); err != nil {
+					return err
+				}
+			}
+			dispatched++
+		}
+		return nil
+	})
 	if err != nil {
+		return 0, err
+	}
+	return dispatched, dispatchErr
+}
+
+func (m *MessageRepository) ClaimMessage(ctx context.Context, id string, revision int, lease time.Duration) (int, error) {
+	claimable := []string{domain.JobStatusScheduled, domain.JobStatusQueued, domain.JobStatusRetrying}
+	var attempt int
+	err := m.PostgresDB.Master.QueryRowContext(ctx, claimMessageQuery, id, domain.JobStatusSending, lease.Seconds(), pq.Array(claimable), revision).Scan(&attempt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return attempt, err
+}
+
+// ScheduleRetry переводит доставляемое сообщение в Failed с повтором в at.
+// В режимах с outbox в той же транзакции пишется запись для relay.
+func (m *MessageRepository) ScheduleRetry(ctx context.Context, id string, at time.Time) error {
+	err := m.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, scheduleRetryQuery, id, domain.JobStatusFailed, at, domain.JobStatusSending)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err == nil {
+				err = sql.ErrNoRows
+			}
+			return err
+		}
+		if !m.Outbox {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, insertOutboxQuery, id)
 		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.transitionError(ctx, id, domain.JobStatusFailed)
 	}
-	return nil
+	return err
+}
+
+// ReleaseExpiredLeases возвращает сообщения с истёкшим захватом в Scheduled: в режиме db
+// их снова опубликует планировщик, в режимах с outbox — relay по новой записи outbox.
+func (m *MessageRepository) ReleaseExpiredLeases(ctx context.Context) (int, error) {
+	query := releaseLeasesQuery
+	if m.Outbox {
+		query = releaseLeasesToOutboxQuery
+	}
+	res, err := m.PostgresDB.Master.ExecContext(ctx, query, domain.JobStatusScheduled, domain.JobStatusSending)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// ReleaseLease возвращает доставляемое сообщение в Scheduled, как ReleaseExpiredLeases,
+// но сразу и только для id.
+func (m *MessageRepository) ReleaseLease(ctx context.Context, id string) error {
+	err := m.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, releaseLeaseQuery, id, domain.JobStatusScheduled, domain.JobStatusSending)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err == nil {
+				err = sql.ErrNoRows
+			}
+			return err
+		}
+		if !m.Outbox {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, insertOutboxQuery, id)
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return m.transitionError(ctx, id, domain.JobStatusScheduled)
+	}
+	return err
+}
+
+func (m *MessageRepository) MarkLostMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	return queryMessages(m.PostgresDB.Master.QueryContext(ctx, markLostQuery, pq.Array(statuses), grace.Seconds(), domain.JobStatusLost))
+}
+
+// RequeueOverdueMessages возвращает просроченные сообщения в Scheduled: в режиме db их
+// опубликует планировщик, в режимах с outbox — relay по записи, вставленной тем же запросом.
+func (m *MessageRepository) RequeueOverdueMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	query := requeueOverdueQuery
+	if m.Outbox {
+		query = requeueOverdueToOutboxQuery
+	}
+	return queryMessages(m.PostgresDB.Master.QueryContext(ctx, query, pq.Array(statuses), grace.Seconds(), domain.JobStatusScheduled))
+}
+
+func (m *MessageRepository) ListOverdueMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	return queryMessages(m.PostgresDB.QueryContext(ctx, listOverdueQuery, pq.Array(statuses), grace.Seconds()))
 }
 
-func createRetryStrategy() retry.Strategy {
-	return retry.Strategy{
-		Attempts: 3,
-		Delay:    5 * time.Second,
-		Backoff:  2}
+// RecordAttempt сохраняет попытку доставки и возвращает присвоенный ей номер.
+func (m *MessageRepository) RecordAttempt(ctx context.Context, attempt domain.DeliveryAttempt) (int, error) {
+	var n int
+	err := m.PostgresDB.Master.QueryRowContext(ctx, insertAttemptQuery, attempt.MessageId, attempt.Channel,
+		attempt.StartedAt, attempt.FinishedAt, attempt.Outcome, attempt.ErrorClass,
+		attempt.ResponseCode, attempt.ResponseBody, attempt.Error).Scan(&n)
+	return n, err
+}
+
+func (m *MessageRepository) ListAttempts(ctx context.Context, messageID string) ([]domain.DeliveryAttempt, error) {
+	rows, err := m.PostgresDB.QueryContext(ctx, listAttemptsQuery, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []domain.DeliveryAttempt
+	for rows.Next() {
+		var a domain.DeliveryAttempt
+		if err := rows.Scan(&a.MessageId, &a.Attempt, &a.Channel, &a.StartedAt, &a.FinishedAt,
+			&a.Outcome, &a.ErrorClass, &a.ResponseCode, &a.ResponseBody, &a.Error); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// RecordDeadLetter сохраняет запись DLQ. Id сообщения, не похожий на UUID, не сохраняется.
+func (m *MessageRepository) RecordDeadLetter(ctx context.Context, letter domain.DeadLetter) error {
+	var messageID any
+	if _, err := uuid.Parse(letter.MessageId); err == nil {
+		messageID = letter.MessageId
+	}
+	_, err := m.PostgresDB.ExecWithRetry(ctx, m.Retry, insertDeadLetterQuery, messageID, letter.Reason, letter.Error, letter.Payload)
+	return err
+}
+
+func (m *MessageRepository) ListDeadLetters(ctx context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error) {
+	var messageID any
+	if filter.MessageId != "" {
+		if _, err := uuid.Parse(filter.MessageId); err != nil {
+			return nil, nil
+		}
+		messageID = filter.MessageId
+	}
+	rows, err := m.PostgresDB.QueryContext(ctx, listDeadLettersQuery, filter.Reason, messageID,
+		nullTime(filter.Since), nullTime(filter.Until), filter.Replayed, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []domain.DeadLetter
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	return letters, rows.Err()
+}
+
+func (m *MessageRepository) GetDeadLetter(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	letter, err := scanDeadLetter(m.PostgresDB.QueryRowContext(ctx, getDeadLetterQuery, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.DeadLetter{}, domain.ErrDeadLetterNotFound
+	}
+	return letter, err
+}
+
+// ReplayDeadLetter в одной транзакции возвращает сообщение записи в Scheduled и закрывает
+// записи DLQ этого сообщения. В режимах с outbox там же пишется запись для relay.
+func (m *MessageRepository) ReplayDeadLetter(ctx context.Context, id int64) (string, error) {
+	var messageID string
+	// без ретраев: ErrNotReplayable и ErrDeadLetterNotFound не исправятся повтором
+	err := m.PostgresDB.WithTx(ctx, func(tx *sql.Tx) error {
+		var ref sql.NullString
+		var replayedAt sql.NullTime
+		err := tx.QueryRowContext(ctx, lockDeadLetterQuery, id).Scan(&ref, &replayedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrDeadLetterNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if replayedAt.Valid {
+			return fmt.Errorf("%w: already replayed at %s", domain.ErrNotReplayable, replayedAt.Time.Format(time.RFC3339))
+		}
+		if !ref.Valid {
+			return fmt.Errorf("%w: no message to replay", domain.ErrNotReplayable)
+		}
+		messageID = ref.String
+
+		res, err := tx.ExecContext(ctx, replayMessageQuery, messageID, domain.JobStatusScheduled, pq.Array(domain.ReplayableStatuses))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err == nil {
+				err = sql.ErrNoRows
+			}
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, markReplayedQuery, messageID); err != nil {
+			return err
+		}
+		if !m.Outbox {
+			return nil
+		}
+		_, err = tx.ExecContext(ctx, insertOutboxQuery, messageID)
+		return err
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		return messageID, err
+	}
+
+	current, err := m.currentStatus(ctx, messageID)
+	if err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("%w: message %s is %s", domain.ErrNotReplayable, messageID, current)
+}
+
+func scanDeadLetter(row rowScanner) (domain.DeadLetter, error) {
+	var letter domain.DeadLetter
+	var messageID sql.NullString
+	var replayedAt sql.NullTime
+	if err := row.Scan(&letter.Id, &messageID, &letter.Reason, &letter.Error, &letter.Payload,
+		&letter.CreatedAt, &replayedAt); err != nil {
+		return domain.DeadLetter{}, err
+	}
+	letter.MessageId = messageID.String
+	if replayedAt.Valid {
+		letter.ReplayedAt = &replayedAt.Time
+	}
+	return letter, nil
+}
+
+// rowScanner — общий интерфейс *sql.Row и *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner) (domain.Message, error) {
+	var msg domain.Message
+	var userID, chatID int64
+	var headers, body []byte
+	var repeatUntil, nextAttemptAt sql.NullTime
+	var parentID, idempotencyKey sql.NullString
+	if err := row.Scan(&msg.Id, &msg.Text, &msg.Status, &msg.ScheduledAt, &userID, &chatID, &msg.Channel, &msg.Email, &msg.Timezone,
+		&msg.WebhookURL, &headers, &body,
+		&msg.Cron, &msg.RRule, &repeatUntil, &msg.MaxOccurrences, &parentID, &msg.Occurrence,
+		&idempotencyKey, &msg.RequestHash, &msg.Revision, &msg.RetryPolicy, &nextAttemptAt, &msg.Priority); err != nil {
+		return domain.Message{}, err
+	}
+	msg.UserId = uint32(userID)
+	msg.TelegramChatId = uint32(chatID)
+	if len(headers) > 0 {
+		if err := json.Unmarshal(headers, &msg.WebhookHeaders); err != nil {
+			return domain.Message{}, err
+		}
+	}
+	if len(body) > 0 {
+		msg.WebhookBody = body
+	}
+	if repeatUntil.Valid {
+		msg.RepeatUntil = &repeatUntil.Time
+	}
+	if nextAttemptAt.Valid {
+		msg.NextAttemptAt = &nextAttemptAt.Time
+	}
+	msg.ParentId = parentID.String
+	msg.IdempotencyKey = idempotencyKey.String
+	return msg, nil
+}
+
+// queryMessages читает все строки результата и закрывает его.
+func queryMessages(rows *sql.Rows, err error) ([]domain.Message, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []domain.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// marshalHeaders сериализует заголовки вебхука в JSONB; пустые хранятся как NULL.
+func marshalHeaders(headers map[string]string) (any, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// nullJSON передаёт JSON строкой (а не []byte, который драйвер отправит как bytea).
+func nullJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// priority — приоритет для записи в БД: пустой хранится как приоритет по умолчанию.
+func priority(message domain.Message) string {
+	if message.Priority == "" {
+		return domain.DefaultPriority
+	}
+	return message.Priority
 }
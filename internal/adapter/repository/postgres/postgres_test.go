@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	migrations "github.com/dontpanicw/DelayedNotifier/pkg/migration/postgres"
+	"github.com/google/uuid"
+	"github.com/wb-go/wbf/dbpg"
+)
+
+// testRepository подключается к TEST_POSTGRES_DSN (отдельная тестовая база) и накатывает
+// миграции; без переменной тест пропускается.
+func testRepository(t *testing.T) *MessageRepository {
+	t.Helper()
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	db, err := dbpg.New(dsn, nil, &dbpg.Options{MaxOpenConns: 2})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := migrations.Migrate(db.Master); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return &MessageRepository{PostgresDB: db, Outbox: true}
+}
+
+// overdueMessage создаёт Scheduled-сообщение с записью outbox, срок которого прошёл 3 часа назад.
+func overdueMessage(t *testing.T, repo *MessageRepository) string {
+	t.Helper()
+	ctx := context.Background()
+	id := uuid.NewString()
+	msg := domain.Message{Id: id, Text: "t", Status: domain.JobStatusScheduled, ScheduledAt: time.Now().Add(-3 * time.Hour),
+		UserId: 1, Channel: domain.ChannelTelegram}
+	if err := repo.CreateMessage(ctx, msg); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _, _ = repo.PostgresDB.Master.Exec(`DELETE FROM messages WHERE id = $1`, id) })
+	if _, err := repo.PostgresDB.Master.ExecContext(ctx,
+		`UPDATE messages SET updated_at = NOW() - interval '3 hours' WHERE id = $1`, id); err != nil {
+		t.Fatalf("backdate: %v", err)
+	}
+	return id
+}
+
+func lostIds(t *testing.T, repo *MessageRepository) map[string]bool {
+	t.Helper()
+	lost, err := repo.MarkLostMessages(context.Background(), []string{domain.JobStatusScheduled}, time.Hour)
+	if err != nil {
+		t.Fatalf("mark lost: %v", err)
+	}
+	ids := map[string]bool{}
+	for _, m := range lost {
+		ids[m.Id] = true
+	}
+	return ids
+}
+
+func TestMarkLostMessages_SkipsPendingOutbox(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	id := overdueMessage(t, repo)
+
+	// RabbitMQ недоступен дольше grace: запись outbox ещё не опубликована
+	if lostIds(t, repo)[id] {
+		t.Fatalf("message waiting for the relay must not be marked lost")
+	}
+
+	// relay опубликовал сообщение только что: grace отсчитывается от публикации
+	if _, err := repo.PostgresDB.Master.ExecContext(ctx,
+		`UPDATE outbox SET dispatched_at = NOW() WHERE message_id = $1`, id); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if lostIds(t, repo)[id] {
+		t.Fatalf("freshly published message must not be marked lost")
+	}
+
+	// а спустя grace после публикации сообщение из очереди действительно пропало
+	if _, err := repo.PostgresDB.Master.ExecContext(ctx,
+		`UPDATE outbox SET dispatched_at = NOW() - interval '2 hours' WHERE message_id = $1`, id); err != nil {
+		t.Fatalf("backdate dispatch: %v", err)
+	}
+	if !lostIds(t, repo)[id] {
+		t.Fatalf("expected message to be marked lost once grace after publishing has passed")
+	}
+}
+
+func TestReconcileQueries_SkipPendingOutbox(t *testing.T) {
+	repo := testRepository(t)
+	ctx := context.Background()
+	id := overdueMessage(t, repo)
+	statuses := []string{domain.JobStatusScheduled}
+
+	has := func(messages []domain.Message) bool {
+		for _, m := range messages {
+			if m.Id == id {
+				return true
+			}
+		}
+		return false
+	}
+	pendingRows := func() int {
+		var n int
+		if err := repo.PostgresDB.Master.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM outbox WHERE message_id = $1 AND dispatched_at IS NULL`, id).Scan(&n); err != nil {
+			t.Fatalf("count outbox: %v", err)
+		}
+		return n
+	}
+
+	overdue, err := repo.ListOverdueMessages(ctx, statuses, time.Hour)
+	if err != nil || has(overdue) {
+		t.Fatalf("message waiting for the relay must not be reported overdue: %v", err)
+	}
+	requeued, err := repo.RequeueOverdueMessages(ctx, statuses, time.Hour)
+	if err != nil || has(requeued) || pendingRows() != 1 {
+		t.Fatalf("message waiting for the relay must not get a second outbox row: %v", err)
+	}
+
+	if _, err := repo.PostgresDB.Master.ExecContext(ctx,
+		`UPDATE outbox SET dispatched_at = NOW() - interval '2 hours' WHERE message_id = $1`, id); err != nil {
+		t.Fatalf("backdate dispatch: %v", err)
+	}
+	requeued, err = repo.RequeueOverdueMessages(ctx, statuses, time.Hour)
+	if err != nil || !has(requeued) || pendingRows() != 1 {
+		t.Fatalf("expected vanished message to be requeued with one new outbox row: %v", err)
+	}
+}
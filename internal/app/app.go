@@ -9,7 +9,6 @@ import (
 
 	"github.com/dontpanicw/DelayedNotifier/config"
 	redisCache "github.com/dontpanicw/DelayedNotifier/internal/adapter/cache/redis"
-	"github.com/dontpanicw/DelayedNotifier/internal/adapter/rabbitmq"
 	http2 "github.com/dontpanicw/DelayedNotifier/internal/input/http"
 	"github.com/dontpanicw/DelayedNotifier/internal/adapter/repository/postgres"
 	"github.com/dontpanicw/DelayedNotifier/internal/usecases"
@@ -31,15 +30,16 @@ func Start(cfg *config.Config) error {
 	messageRepo := postgres.NewMessageRepository(cfg)
 	statusCache := redisCache.NewStatusCache(cfg.RedisAddr)
 
-	messageQueue, err := rabbitmq.NewMessageQueueProducer(cfg.RabbitURL)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer messageQueue.Close()
+	// API только пишет в БД: наступившие сообщения публикует планировщик воркера (режим db),
+	// а в режимах broker и timer — relay outbox, запись которого репозиторий
+	// делает в одной транзакции с сообщением
+	cancelBus := redisCache.NewCancelBus(cfg.RedisAddr)
+	messageUsecase := usecases.NewMessageUsecases(messageRepo, nil, statusCache, cancelBus, cfg.RetryPolicies)
 
-	messageUsecase := usecases.NewMessageUsecases(messageRepo, messageQueue, statusCache)
-
-	srv := http2.NewServer(messageUsecase)
+	srv := http2.NewServer(messageUsecase, cfg.AdminToken)
+	if cfg.AdminToken == "" {
+		log.Print("ADMIN_TOKEN is not set, DLQ admin endpoints are disabled")
+	}
 
 	log.Printf("Starting server on %s", cfg.HTTPPort)
 	return http.ListenAndServe(cfg.HTTPPort, srv)
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+const (
+	AttemptSucceeded = "Succeeded"
+	AttemptFailed    = "Failed"
+)
+
+// Классы ошибок попытки доставки.
+const (
+	// ErrorClassTemporary — сбой, после которого попытку имеет смысл повторить (5xx, 429, сеть).
+	ErrorClassTemporary = "temporary"
+	// ErrorClassPermanent — получатель отверг сообщение, повтор не поможет (4xx, нет канала).
+	ErrorClassPermanent = "permanent"
+	// ErrorClassTimeout — провайдер не ответил вовремя.
+	ErrorClassTimeout = "timeout"
+	// ErrorClassCancelled — попытку прервала остановка воркера.
+	ErrorClassCancelled = "cancelled"
+)
+
+// DeliveryAttempt — одна попытка доставки сообщения воркером.
+type DeliveryAttempt struct {
+	MessageId string `json:"message_id"`
+	// Attempt — номер попытки в пределах сообщения, сквозной между повторными получениями.
+	Attempt    int       `json:"attempt"`
+	Channel    string    `json:"channel"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Outcome    string    `json:"outcome"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	// ResponseCode и ResponseBody — код и начало ответа провайдера, если он ответил.
+	ResponseCode int    `json:"response_code,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
@@ -0,0 +1,52 @@
+package domain
+
+import "time"
+
+// Причины попадания сообщения в DLQ.
+const (
+	// DeadLetterUnparseable — тело не разбирается как сообщение.
+	DeadLetterUnparseable = "unparseable"
+	// DeadLetterTerminallyFailed — доставка не удалась, и повторять её по политике нельзя.
+	DeadLetterTerminallyFailed = "terminally_failed"
+	// DeadLetterExpired — сообщение пролежало в очереди дольше TTL (причина брокера).
+	DeadLetterExpired = "expired"
+	// DeadLetterRejected — сообщение отклонено без повторной постановки (причина брокера).
+	DeadLetterRejected = "rejected"
+)
+
+// DeadLetter — сообщение, попавшее в notifications.dlq, с причиной.
+type DeadLetter struct {
+	Id int64 `json:"id"`
+	// MessageId пуст, если тело не удалось разобрать.
+	MessageId string `json:"message_id,omitempty"`
+	Reason    string `json:"reason"`
+	Error     string `json:"error,omitempty"`
+	// Payload — исходное тело из очереди; в списке не возвращается.
+	Payload    string     `json:"payload,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReplayedAt *time.Time `json:"replayed_at,omitempty"`
+}
+
+// DeadLetterFilter отбирает записи DLQ для списка и массового повтора.
+// Пустые поля не ограничивают выборку.
+type DeadLetterFilter struct {
+	Reason    string
+	MessageId string
+	Since     time.Time
+	Until     time.Time
+	// Replayed — включать уже повторённые записи.
+	Replayed bool
+	Limit    int
+}
+
+// ReplayResult — итог повтора записей DLQ.
+type ReplayResult struct {
+	Replayed []int64 `json:"replayed"`
+	// Skipped — записи, которые повторить нельзя, с причиной.
+	Skipped []ReplaySkip `json:"skipped"`
+}
+
+type ReplaySkip struct {
+	Id    int64  `json:"id"`
+	Error string `json:"error"`
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "errors"
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrMessageExists   = errors.New("message already exists")
+	// ErrIdempotencyConflict — ключ идемпотентности уже использован с другим телом запроса.
+	ErrIdempotencyConflict = errors.New("idempotency key already used with a different request")
+	// ErrInvalidTransition — базовая ошибка для *TransitionError.
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrNotPending — сообщение уже отправляется, доставлено или отменено, менять его поздно.
+	ErrNotPending = errors.New("message is no longer pending")
+	// ErrDeadLetterNotFound — записи DLQ с таким id нет.
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrNotReplayable — запись DLQ уже повторена, не ссылается на сообщение
+	// или сообщение успело выйти из Terminally_Failed/Lost.
+	ErrNotReplayable = errors.New("dead letter cannot be replayed")
+)
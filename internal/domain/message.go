@@ -1,14 +1,82 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 const (
 	JobStatusScheduled        = "Scheduled"
 	JobStatusSent             = "Sent"
-	JobStatusFailed           = "Failed"
 	JobStatusTerminallyFailed = "Terminally_Failed"
+
+	// JobStatusQueued — срок наступил, планировщик передал сообщение в очередь воркерам.
+	JobStatusQueued = "Queued"
+	// JobStatusSending — воркер захватил сообщение и доставляет его; захват действует до lease_until.
+	JobStatusSending = "Sending"
+	// JobStatusLost — сообщение пропало из очереди (истёк TTL или потеряно брокером)
+	// и уже не будет доставлено воркером.
+	JobStatusLost = "Lost"
+	// JobStatusFailed — попытка не удалась, повтор назначен на next_attempt_at.
+	JobStatusFailed = "Failed"
+	// JobStatusRetrying — повторная попытка передана в очередь воркерам.
+	JobStatusRetrying = "Retrying"
+	// JobStatusCancelled — уведомление отменено пользователем.
+	JobStatusCancelled = "Cancelled"
+
+	// JobStatusRecurring — статус родительской записи повторяющегося уведомления.
+	// Сама она не доставляется: по расписанию создаются дочерние вхождения.
+	JobStatusRecurring = "Recurring"
+	// JobStatusCompleted — расписание исчерпано (repeat_until или max_occurrences).
+	JobStatusCompleted = "Completed"
+)
+
+const (
+	ChannelTelegram = "telegram"
+	ChannelEmail    = "email"
+	ChannelWebhook  = "webhook"
+
+	DefaultChannel = ChannelTelegram
+)
+
+// IsKnownChannel сообщает, поддерживается ли канал доставки.
+func IsKnownChannel(channel string) bool {
+	switch channel {
+	case ChannelTelegram, ChannelEmail, ChannelWebhook:
+		return true
+	}
+	return false
+}
+
+// Приоритеты уведомлений: срочные обгоняют в очереди массовые рассылки.
+const (
+	PriorityCritical = "critical"
+	PriorityHigh     = "high"
+	PriorityNormal   = "normal"
+	PriorityBulk     = "bulk"
+
+	DefaultPriority = PriorityNormal
 )
 
+// MaxPriorityLevel — x-max-priority очереди notifications.queue.
+const MaxPriorityLevel = 4
+
+// PriorityLevel переводит приоритет в приоритет сообщения RabbitMQ (больше — раньше).
+// Пустой приоритет — DefaultPriority; ok == false — приоритет неизвестен.
+func PriorityLevel(priority string) (level uint8, ok bool) {
+	switch priority {
+	case PriorityCritical:
+		return 4, true
+	case PriorityHigh:
+		return 3, true
+	case PriorityNormal, "":
+		return 2, true
+	case PriorityBulk:
+		return 1, true
+	}
+	return 0, false
+}
+
 type Message struct {
 	Id             string    `json:"id"`
 	Text           string    `json:"text"`
@@ -16,4 +84,97 @@ type Message struct {
 	ScheduledAt    time.Time `json:"scheduled_at"`
 	UserId         uint32    `json:"user_id"`
 	TelegramChatId uint32    `json:"telegram_chat_id"`
+	Channel        string    `json:"channel"`
+	Email          string    `json:"email,omitempty"`
+	// Timezone — IANA-зона получателя: в ней вычисляются повторения
+	// и показывается время. Пустая строка означает UTC.
+	Timezone string `json:"timezone,omitempty"`
+
+	WebhookURL     string            `json:"webhook_url,omitempty"`
+	WebhookHeaders map[string]string `json:"webhook_headers,omitempty"`
+	WebhookBody    json.RawMessage   `json:"webhook_body,omitempty"`
+
+	// Cron (5 полей) или RRule (RFC 5545) задают повторение,
+	// RepeatUntil и MaxOccurrences — его границы.
+	Cron           string     `json:"cron,omitempty"`
+	RRule          string     `json:"rrule,omitempty"`
+	RepeatUntil    *time.Time `json:"repeat_until,omitempty"`
+	MaxOccurrences int        `json:"max_occurrences,omitempty"`
+	// ParentId и Occurrence заполнены у вхождения повторяющегося уведомления.
+	ParentId   string `json:"parent_id,omitempty"`
+	Occurrence int    `json:"occurrence,omitempty"`
+
+	// IdempotencyKey (уникален в пределах пользователя) и RequestHash — отпечаток тела
+	// запроса создания: повтор с тем же ключом и телом возвращает исходное уведомление.
+	IdempotencyKey string `json:"-"`
+	RequestHash    string `json:"-"`
+
+	// Revision растёт при каждом изменении ожидающего сообщения и едет в теле сообщения
+	// очереди: воркер не захватывает копию, опубликованную до изменения.
+	Revision int `json:"revision,omitempty"`
+
+	// RetryPolicy — имя политики повторов сообщения; пустое — политика канала.
+	RetryPolicy string `json:"retry_policy,omitempty"`
+	// NextAttemptAt — срок повторной попытки после временной ошибки доставки.
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+
+	// Priority — critical, high, normal или bulk; пустой — DefaultPriority.
+	Priority string `json:"priority,omitempty"`
+}
+
+// DueAt возвращает момент, когда сообщение пора доставлять: срок повтора или scheduled_at.
+func (m Message) DueAt() time.Time {
+	if m.NextAttemptAt != nil {
+		return *m.NextAttemptAt
+	}
+	return m.ScheduledAt
+}
+
+// MessagePatch — изменение ожидающего сообщения; nil-поля не меняются.
+type MessagePatch struct {
+	Text           *string
+	ScheduledAt    *time.Time
+	Timezone       *string
+	TelegramChatId *uint32
+	Email          *string
+	WebhookURL     *string
+}
+
+// Apply применяет изменение к сообщению.
+func (p MessagePatch) Apply(m *Message) {
+	if p.Text != nil {
+		m.Text = *p.Text
+	}
+	if p.ScheduledAt != nil {
+		m.ScheduledAt = *p.ScheduledAt
+	}
+	if p.Timezone != nil {
+		m.Timezone = *p.Timezone
+	}
+	if p.TelegramChatId != nil {
+		m.TelegramChatId = *p.TelegramChatId
+	}
+	if p.Email != nil {
+		m.Email = *p.Email
+	}
+	if p.WebhookURL != nil {
+		m.WebhookURL = *p.WebhookURL
+	}
+}
+
+// Location возвращает зону получателя; неизвестная или пустая зона трактуется как UTC.
+func (m Message) Location() *time.Location {
+	if m.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(m.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsRecurring сообщает, является ли сообщение родителем серии повторений.
+func (m Message) IsRecurring() bool {
+	return m.Cron != "" || m.RRule != ""
 }
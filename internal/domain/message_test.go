@@ -0,0 +1,21 @@
+package domain
+
+import "testing"
+
+func TestPriorityLevel(t *testing.T) {
+	order := []string{PriorityBulk, PriorityNormal, PriorityHigh, PriorityCritical}
+	var prev uint8
+	for _, p := range order {
+		level, ok := PriorityLevel(p)
+		if !ok || level <= prev || level > MaxPriorityLevel {
+			t.Fatalf("unexpected level %d for %s after %d", level, p, prev)
+		}
+		prev = level
+	}
+	if level, ok := PriorityLevel(""); !ok || level != 2 {
+		t.Fatalf("expected empty priority to mean normal, got %d", level)
+	}
+	if _, ok := PriorityLevel("urgent"); ok {
+		t.Fatalf("expected unknown priority to be rejected")
+	}
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// Политики сверки для сообщений, которые ждут воркера дольше grace после срока.
+const (
+	// ReconcileRequeue — поставить сообщение в очередь заново с новой ревизией.
+	ReconcileRequeue = "requeue"
+	// ReconcileFail — пометить сообщение Lost; серия продолжается со следующего вхождения.
+	ReconcileFail = "fail"
+	// ReconcileAlert — только сообщить о расхождении, ничего не меняя.
+	ReconcileAlert = "alert"
+)
+
+// IsReconcilePolicy сообщает, что policy — известная политика сверки.
+func IsReconcilePolicy(policy string) bool {
+	switch policy {
+	case ReconcileRequeue, ReconcileFail, ReconcileAlert:
+		return true
+	}
+	return false
+}
+
+// ReconcileReport — итог одного прохода сверки.
+type ReconcileReport struct {
+	Policy     string    `json:"policy"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Overdue — сколько просроченных сообщений найдено (и обработано по политике).
+	Overdue int `json:"overdue"`
+	// MessageIds — первые из них, не больше ReconcileReportIds.
+	MessageIds []string `json:"message_ids"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ReconcileReportIds — сколько id сообщений попадает в отчёт сверки.
+const ReconcileReportIds = 100
@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"math"
+	"time"
+)
+
+// Имена встроенных политик повторов; любую можно переопределить в RETRY_POLICIES.
+const (
+	// DefaultRetryPolicy — доставка уведомлений, если ни сообщение, ни канал не указали иную.
+	DefaultRetryPolicy = "default"
+	// PostgresRetryPolicy и RabbitMQRetryPolicy — повторы запросов к Postgres и публикаций в RabbitMQ.
+	PostgresRetryPolicy = "postgres"
+	RabbitMQRetryPolicy = "rabbitmq"
+)
+
+// RetryPolicy — правило повторных попыток.
+type RetryPolicy struct {
+	// MaxAttempts — всего попыток, включая первую.
+	MaxAttempts int
+	// BaseDelay — задержка перед первым повтором; каждая следующая больше в Multiplier раз,
+	// но не больше MaxDelay (0 — без потолка).
+	BaseDelay  time.Duration
+	Multiplier float64
+	MaxDelay   time.Duration
+	// Delays — задержки перед повторами по порядку, последняя действует и дальше.
+	// Если заданы, заменяют BaseDelay и Multiplier; MaxDelay и Jitter применяются и к ним.
+	Delays []time.Duration
+	// Jitter — доля случайного разброса задержки (0.1 — ±10%), чтобы повторы не шли волной.
+	Jitter float64
+	// MaxAge — после scheduled_at + MaxAge повторов больше нет (0 — без ограничения).
+	MaxAge time.Duration
+}
+
+// Delay возвращает задержку перед повтором после failed неудачных попыток (failed ≥ 1).
+// rnd — случайное число из [0, 1) для разброса.
+func (p RetryPolicy) Delay(failed int, rnd float64) time.Duration {
+	var d float64
+	if len(p.Delays) > 0 {
+		d = float64(p.Delays[min(failed, len(p.Delays))-1])
+	} else {
+		multiplier := p.Multiplier
+		if multiplier < 1 {
+			multiplier = 1
+		}
+		d = float64(p.BaseDelay) * math.Pow(multiplier, float64(failed-1))
+	}
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rnd-1)
+	}
+	return time.Duration(d)
+}
+
+// NextAttempt решает, повторять ли доставку после failed неудачных попыток сообщения
+// со сроком scheduledAt, и возвращает момент повтора. minDelay — пауза, которую
+// запросил провайдер (например, retry_after Telegram).
+func (p RetryPolicy) NextAttempt(failed int, scheduledAt, now time.Time, minDelay time.Duration, rnd float64) (time.Time, bool) {
+	if failed >= p.MaxAttempts {
+		return time.Time{}, false
+	}
+	next := now.Add(max(p.Delay(failed, rnd), minDelay))
+	if p.MaxAge > 0 && next.After(scheduledAt.Add(p.MaxAge)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// RetryPolicies — именованные политики повторов и их назначение каналам доставки.
+type RetryPolicies struct {
+	Policies map[string]RetryPolicy
+	// Channels — имя политики канала; канал без записи получает DefaultRetryPolicy.
+	Channels map[string]string
+}
+
+// DefaultRetryPolicies возвращает встроенные политики.
+func DefaultRetryPolicies() RetryPolicies {
+	return RetryPolicies{
+		Policies: map[string]RetryPolicy{
+			// 10с, 40с, 90с — прежние зашитые в воркер задержки, теперь с разбросом ±10%
+			DefaultRetryPolicy:  {MaxAttempts: 4, Delays: []time.Duration{10 * time.Second, 40 * time.Second, 90 * time.Second}, Jitter: 0.1, MaxAge: 24 * time.Hour},
+			PostgresRetryPolicy: {MaxAttempts: 3, BaseDelay: 5 * time.Second, Multiplier: 2},
+			RabbitMQRetryPolicy: {MaxAttempts: 3, BaseDelay: 3 * time.Second, Multiplier: 2},
+		},
+		Channels: map[string]string{},
+	}
+}
+
+// Has сообщает, определена ли политика name.
+func (r RetryPolicies) Has(name string) bool {
+	_, ok := r.Policies[name]
+	return ok
+}
+
+// For выбирает политику доставки сообщения: заданную при создании, затем политику
+// канала, затем DefaultRetryPolicy.
+func (r RetryPolicies) For(m Message) RetryPolicy {
+	if p, ok := r.Policies[m.RetryPolicy]; ok {
+		return p
+	}
+	if p, ok := r.Policies[r.Channels[m.Channel]]; ok {
+		return p
+	}
+	return r.Policies[DefaultRetryPolicy]
+}
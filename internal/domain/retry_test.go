@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Second, Multiplier: 3, MaxDelay: time.Minute}
+
+	want := []time.Duration{10 * time.Second, 30 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		if got := p.Delay(i+1, 0.5); got != w {
+			t.Fatalf("delay after %d failures: expected %s, got %s", i+1, w, got)
+		}
+	}
+
+	p.Jitter = 0.2
+	if lo, hi := p.Delay(1, 0), p.Delay(1, 0.999); lo != 8*time.Second || hi <= 11*time.Second || hi > 12*time.Second {
+		t.Fatalf("expected ±20%% jitter around 10s, got %s..%s", lo, hi)
+	}
+}
+
+func TestRetryPolicy_DelayList(t *testing.T) {
+	p := DefaultRetryPolicies().Policies[DefaultRetryPolicy]
+	p.Jitter = 0
+
+	// прежнее расписание воркера; последняя задержка действует и дальше
+	want := []time.Duration{10 * time.Second, 40 * time.Second, 90 * time.Second, 90 * time.Second}
+	for i, w := range want {
+		if got := p.Delay(i+1, 0.5); got != w {
+			t.Fatalf("delay after %d failures: expected %s, got %s", i+1, w, got)
+		}
+	}
+}
+
+func TestRetryPolicy_NextAttempt(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, Multiplier: 2, MaxAge: 10 * time.Minute}
+	scheduled := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	next, ok := p.NextAttempt(1, scheduled, scheduled, 0, 0.5)
+	if !ok || !next.Equal(scheduled.Add(time.Minute)) {
+		t.Fatalf("expected retry in 1m, got %s %v", next, ok)
+	}
+	// провайдер просит подождать дольше политики
+	if next, _ := p.NextAttempt(1, scheduled, scheduled, 5*time.Minute, 0.5); !next.Equal(scheduled.Add(5 * time.Minute)) {
+		t.Fatalf("expected retry_after to win, got %s", next)
+	}
+	if _, ok := p.NextAttempt(3, scheduled, scheduled, 0, 0.5); ok {
+		t.Fatalf("expected no retry after max attempts")
+	}
+	if _, ok := p.NextAttempt(2, scheduled, scheduled.Add(9*time.Minute), 0, 0.5); ok {
+		t.Fatalf("expected no retry past max age")
+	}
+}
+
+func TestRetryPolicies_For(t *testing.T) {
+	r := DefaultRetryPolicies()
+	r.Policies["patient"] = RetryPolicy{MaxAttempts: 10}
+	r.Policies["urgent"] = RetryPolicy{MaxAttempts: 2}
+	r.Channels[ChannelEmail] = "patient"
+
+	if got := r.For(Message{Channel: ChannelEmail}); got.MaxAttempts != 10 {
+		t.Fatalf("expected channel policy, got %+v", got)
+	}
+	if got := r.For(Message{Channel: ChannelEmail, RetryPolicy: "urgent"}); got.MaxAttempts != 2 {
+		t.Fatalf("expected message policy to override channel, got %+v", got)
+	}
+	if got := r.For(Message{Channel: ChannelTelegram}); !reflect.DeepEqual(got, r.Policies[DefaultRetryPolicy]) {
+		t.Fatalf("expected default policy, got %+v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+)
+
+// transitions — жизненный цикл сообщения: из какого статуса в какие можно перейти.
+// Финальные статусы (Sent, Terminally_Failed, Cancelled, Completed, Lost) переходов не имеют.
+// Retrying → Scheduled — сверка заново ставит в очередь сообщение, пропавшее из неё.
+var transitions = map[string][]string{
+	JobStatusScheduled: {JobStatusQueued, JobStatusSending, JobStatusLost, JobStatusCancelled},
+	JobStatusQueued:    {JobStatusSending, JobStatusScheduled, JobStatusLost, JobStatusCancelled},
+	// Sending → Scheduled — истёк захват упавшего воркера, Sending → Sending — его перехват
+	JobStatusSending:   {JobStatusSent, JobStatusFailed, JobStatusTerminallyFailed, JobStatusScheduled, JobStatusSending},
+	JobStatusFailed:    {JobStatusRetrying, JobStatusTerminallyFailed, JobStatusCancelled},
+	JobStatusRetrying:  {JobStatusQueued, JobStatusSending, JobStatusScheduled, JobStatusLost, JobStatusCancelled},
+	JobStatusRecurring: {JobStatusCompleted, JobStatusCancelled},
+}
+
+// CanTransition сообщает, допустим ли переход from → to.
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PreviousStatuses возвращает статусы, из которых допустим переход в to.
+// Репозиторий использует их как условие compare-and-swap.
+func PreviousStatuses(to string) []string {
+	var res []string
+	for from, next := range transitions {
+		for _, s := range next {
+			if s == to {
+				res = append(res, from)
+				break
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// PendingStatuses — сообщение ещё ждёт срока или захвата воркером и его можно изменить.
+var PendingStatuses = []string{JobStatusScheduled, JobStatusQueued}
+
+// IsPending сообщает, что статус входит в PendingStatuses.
+func IsPending(status string) bool {
+	for _, s := range PendingStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ReplayableStatuses — из них сообщение возвращается в Scheduled повтором из DLQ.
+// Это ручное действие администратора, в обычный жизненный цикл оно не входит.
+var ReplayableStatuses = []string{JobStatusTerminallyFailed, JobStatusLost}
+
+// IsFinal сообщает, что статус окончательный и больше не изменится.
+func IsFinal(status string) bool {
+	_, ok := transitions[status]
+	return !ok
+}
+
+// TransitionError — переход статуса недопустим: либо запрещён жизненным циклом,
+// либо статус успел измениться (например, отмена выиграла гонку у отправки).
+type TransitionError struct {
+	Id   string
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("message %s: illegal status transition %s -> %s", e.Id, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
@@ -0,0 +1,47 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to string
+		want     bool
+	}{
+		{JobStatusScheduled, JobStatusSending, true},
+		{JobStatusSending, JobStatusSent, true},
+		{JobStatusSending, JobStatusFailed, true},
+		{JobStatusFailed, JobStatusRetrying, true},
+		{JobStatusRetrying, JobStatusScheduled, true},
+		{JobStatusScheduled, JobStatusCancelled, true},
+		{JobStatusSent, JobStatusScheduled, false},
+		{JobStatusCancelled, JobStatusSending, false},
+		{JobStatusScheduled, JobStatusSent, false},
+	}
+	for _, c := range cases {
+		if got := CanTransition(c.from, c.to); got != c.want {
+			t.Fatalf("CanTransition(%s, %s) = %v, want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestPreviousStatuses(t *testing.T) {
+	got := PreviousStatuses(JobStatusSent)
+	if len(got) != 1 || got[0] != JobStatusSending {
+		t.Fatalf("expected only Sending to lead to Sent, got %v", got)
+	}
+	for _, s := range PreviousStatuses(JobStatusCancelled) {
+		if IsFinal(s) {
+			t.Fatalf("final status %s must not lead to Cancelled", s)
+		}
+	}
+}
+
+func TestTransitionError_Is(t *testing.T) {
+	var err error = &TransitionError{Id: "1", From: JobStatusSent, To: JobStatusScheduled}
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected TransitionError to match ErrInvalidTransition")
+	}
+}
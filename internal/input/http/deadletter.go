@@ -0,0 +1,153 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+func (s *Server) handleListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := domain.DeadLetterFilter{
+		Reason:    q.Get("reason"),
+		MessageId: q.Get("message_id"),
+		Replayed:  q.Get("replayed") == "true",
+	}
+	var err error
+	if filter.Since, err = parseOptionalTime(q.Get("since")); err != nil {
+		http.Error(w, "invalid since, use RFC3339", http.StatusBadRequest)
+		return
+	}
+	if filter.Until, err = parseOptionalTime(q.Get("until")); err != nil {
+		http.Error(w, "invalid until, use RFC3339", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	letters, err := s.uc.ListDeadLetters(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if letters == nil {
+		letters = []domain.DeadLetter{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"dead_letters": letters})
+}
+
+func (s *Server) handleGetDeadLetter(w http.ResponseWriter, r *http.Request, rawID string) {
+	id, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	letter, err := s.uc.GetDeadLetter(r.Context(), id)
+	if errors.Is(err, domain.ErrDeadLetterNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	letter.Payload = maskPayload(letter.Payload)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(letter)
+}
+
+// maskPayload скрывает значения webhook_headers в исходном теле из очереди; остальные
+// поля, включая неизвестные, остаются как есть. Неразбираемое тело возвращается без изменений.
+func maskPayload(payload string) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return payload
+	}
+	raw, ok := fields["webhook_headers"]
+	if !ok {
+		return payload
+	}
+	var headers map[string]string
+	if err := json.Unmarshal(raw, &headers); err != nil {
+		// заголовки другой формы не показываются вовсе
+		delete(fields, "webhook_headers")
+	} else {
+		fields["webhook_headers"], _ = json.Marshal(maskHeaders(headers))
+	}
+	masked, err := json.Marshal(fields)
+	if err != nil {
+		return payload
+	}
+	return string(masked)
+}
+
+// replayDeadLettersRequest — выбранные записи (ids) или фильтр для массового повтора.
+type replayDeadLettersRequest struct {
+	Ids    []int64 `json:"ids"`
+	Filter *struct {
+		Reason    string `json:"reason"`
+		MessageId string `json:"message_id"`
+		Since     string `json:"since"`
+		Until     string `json:"until"`
+		Limit     int    `json:"limit"`
+	} `json:"filter"`
+}
+
+func (s *Server) handleReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	var req replayDeadLettersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(req.Ids) == 0 && req.Filter == nil {
+		http.Error(w, "ids or filter is required", http.StatusBadRequest)
+		return
+	}
+
+	var filter *domain.DeadLetterFilter
+	if req.Filter != nil && len(req.Ids) == 0 {
+		filter = &domain.DeadLetterFilter{
+			Reason:    req.Filter.Reason,
+			MessageId: req.Filter.MessageId,
+			Limit:     req.Filter.Limit,
+		}
+		var err error
+		if filter.Since, err = parseOptionalTime(req.Filter.Since); err != nil {
+			http.Error(w, "invalid since, use RFC3339", http.StatusBadRequest)
+			return
+		}
+		if filter.Until, err = parseOptionalTime(req.Filter.Until); err != nil {
+			http.Error(w, "invalid until, use RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := s.uc.ReplayDeadLetters(r.Context(), req.Ids, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// parseOptionalTime разбирает RFC3339; пустая строка — нулевое время (без ограничения).
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -1,11 +1,16 @@
 package http
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/pkg/schedule"
 )
 
 type createNotificationRequest struct {
@@ -13,6 +18,26 @@ type createNotificationRequest struct {
 	ScheduledAt    string `json:"scheduled_at"`
 	UserID         uint32 `json:"user_id"`
 	TelegramChatID uint32 `json:"telegram_chat_id"`
+	Channel        string `json:"channel"`
+	Email          string `json:"email"`
+
+	// ScheduledLocal — время без смещения, трактуется в зоне Timezone.
+	ScheduledLocal string `json:"scheduled_local"`
+	Timezone       string `json:"timezone"`
+
+	WebhookURL     string            `json:"webhook_url"`
+	WebhookHeaders map[string]string `json:"webhook_headers"`
+	WebhookBody    json.RawMessage   `json:"webhook_body"`
+
+	Cron           string `json:"cron"`
+	RRule          string `json:"rrule"`
+	RepeatUntil    string `json:"repeat_until"`
+	MaxOccurrences int    `json:"max_occurrences"`
+
+	// RetryPolicy — имя политики повторов вместо политики канала.
+	RetryPolicy string `json:"retry_policy"`
+	// Priority — critical, high, normal (по умолчанию) или bulk.
+	Priority string `json:"priority"`
 }
 
 func (s *Server) handleCreateNotification(w http.ResponseWriter, r *http.Request) {
@@ -27,10 +52,37 @@ func (s *Server) handleCreateNotification(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	scheduledAt, err := time.Parse(time.RFC3339, req.ScheduledAt)
-	if err != nil {
-		http.Error(w, "invalid scheduled_at, use RFC3339", http.StatusBadRequest)
-		return
+	// для повторяющихся уведомлений scheduled_at — необязательное начало серии
+	var scheduledAt time.Time
+	switch {
+	case req.ScheduledLocal != "":
+		if req.ScheduledAt != "" {
+			http.Error(w, "scheduled_at and scheduled_local are mutually exclusive", http.StatusBadRequest)
+			return
+		}
+		t, err := parseLocal(req.ScheduledLocal, req.Timezone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		scheduledAt = t
+	case req.ScheduledAt != "" || (req.Cron == "" && req.RRule == ""):
+		t, err := time.Parse(time.RFC3339, req.ScheduledAt)
+		if err != nil {
+			http.Error(w, "invalid scheduled_at, use RFC3339", http.StatusBadRequest)
+			return
+		}
+		scheduledAt = t
+	}
+
+	var repeatUntil *time.Time
+	if req.RepeatUntil != "" {
+		t, err := time.Parse(time.RFC3339, req.RepeatUntil)
+		if err != nil {
+			http.Error(w, "invalid repeat_until, use RFC3339", http.StatusBadRequest)
+			return
+		}
+		repeatUntil = &t
 	}
 
 	msg := domain.Message{
@@ -38,19 +90,90 @@ func (s *Server) handleCreateNotification(w http.ResponseWriter, r *http.Request
 		ScheduledAt:    scheduledAt,
 		UserId:         req.UserID,
 		TelegramChatId: req.TelegramChatID,
+		Channel:        req.Channel,
+		Email:          req.Email,
+		Timezone:       req.Timezone,
+		WebhookURL:     req.WebhookURL,
+		WebhookHeaders: req.WebhookHeaders,
+		WebhookBody:    req.WebhookBody,
+		Cron:           req.Cron,
+		RRule:          req.RRule,
+		RepeatUntil:    repeatUntil,
+		MaxOccurrences: req.MaxOccurrences,
+		RetryPolicy:    req.RetryPolicy,
+		Priority:       req.Priority,
+	}
+
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		if len(key) > maxIdempotencyKeyLen {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+		msg.IdempotencyKey = key
+		msg.RequestHash = requestHash(req)
 	}
 
-	id, err := s.uc.CreateAndSendMessage(r.Context(), msg)
+	id, replayed, err := s.uc.CreateAndSendMessage(r.Context(), msg)
+	if errors.Is(err, domain.ErrIdempotencyConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if replayed {
+		// повтор запроса: уведомление уже создано, отдаём его текущий статус
+		status, err := s.uc.GetMessageStatus(r.Context(), id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": id, "status": status})
+		return
+	}
 	w.WriteHeader(http.StatusCreated)
 	_ = json.NewEncoder(w).Encode(map[string]string{"id": id})
 }
 
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// requestHash — отпечаток тела запроса создания. Считается по разобранной структуре,
+// поэтому порядок полей и пробелы в JSON на него не влияют.
+func requestHash(req createNotificationRequest) string {
+	b, _ := json.Marshal(req)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// localLayouts — допустимые форматы scheduled_local (без смещения).
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// parseLocal переводит настенное время в зоне tz в момент времени
+// по правилам schedule.ResolveLocal для переходов DST.
+func parseLocal(value, tz string) (time.Time, error) {
+	if tz == "" {
+		return time.Time{}, errors.New("timezone is required with scheduled_local")
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", tz)
+	}
+	for _, layout := range localLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return schedule.ResolveLocal(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), loc), nil
+		}
+	}
+	return time.Time{}, errors.New("invalid scheduled_local, use YYYY-MM-DDTHH:MM[:SS]")
+}
+
 func (s *Server) handleListNotifications(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -63,8 +186,13 @@ func (s *Server) handleListNotifications(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	masked := make([]domain.Message, len(messages))
+	for i, message := range messages {
+		masked[i] = maskMessage(message)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(messages)
+	_ = json.NewEncoder(w).Encode(masked)
 }
 
 func (s *Server) handleGetNotificationStatus(w http.ResponseWriter, r *http.Request, id string) {
@@ -78,13 +206,183 @@ func (s *Server) handleGetNotificationStatus(w http.ResponseWriter, r *http.Requ
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": status})
 }
 
+// defaultPreviewWindow — диапазон предпросмотра, если "to" не передан.
+const defaultPreviewWindow = 30 * 24 * time.Hour
+
+func (s *Server) handleListOccurrences(w http.ResponseWriter, r *http.Request, id string) {
+	from := time.Now()
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid from, use RFC3339", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	to := from.Add(defaultPreviewWindow)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid to, use RFC3339", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+
+	occurrences, err := s.uc.ListOccurrences(r.Context(), id, from, to)
+	if errors.Is(err, domain.ErrMessageNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"occurrences": occurrences})
+}
+
+func (s *Server) handleListAttempts(w http.ResponseWriter, r *http.Request, id string) {
+	attempts, err := s.uc.ListAttempts(r.Context(), id)
+	if errors.Is(err, domain.ErrMessageNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if attempts == nil {
+		attempts = []domain.DeliveryAttempt{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"attempts": attempts})
+}
+
+// updateNotificationRequest — тело PATCH: переданные поля меняются, остальные остаются.
+type updateNotificationRequest struct {
+	Text           *string `json:"text"`
+	ScheduledAt    *string `json:"scheduled_at"`
+	ScheduledLocal *string `json:"scheduled_local"`
+	Timezone       *string `json:"timezone"`
+	TelegramChatID *uint32 `json:"telegram_chat_id"`
+	Email          *string `json:"email"`
+	WebhookURL     *string `json:"webhook_url"`
+}
+
+func (s *Server) handleUpdateNotification(w http.ResponseWriter, r *http.Request, id string) {
+	var req updateNotificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	patch := domain.MessagePatch{
+		Text:           req.Text,
+		Timezone:       req.Timezone,
+		TelegramChatId: req.TelegramChatID,
+		Email:          req.Email,
+		WebhookURL:     req.WebhookURL,
+	}
+	switch {
+	case req.ScheduledLocal != nil:
+		if req.ScheduledAt != nil {
+			http.Error(w, "scheduled_at and scheduled_local are mutually exclusive", http.StatusBadRequest)
+			return
+		}
+		var tz string
+		if req.Timezone != nil {
+			tz = *req.Timezone
+		}
+		t, err := parseLocal(*req.ScheduledLocal, tz)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		patch.ScheduledAt = &t
+	case req.ScheduledAt != nil:
+		t, err := time.Parse(time.RFC3339, *req.ScheduledAt)
+		if err != nil {
+			http.Error(w, "invalid scheduled_at, use RFC3339", http.StatusBadRequest)
+			return
+		}
+		patch.ScheduledAt = &t
+	}
+
+	message, err := s.uc.UpdateMessage(r.Context(), id, patch)
+	writeUpdated(w, message, err)
+}
+
+func (s *Server) handleSnoozeNotification(w http.ResponseWriter, r *http.Request, id string) {
+	d, err := time.ParseDuration(r.URL.Query().Get("for"))
+	if err != nil || d <= 0 {
+		http.Error(w, "invalid for, use a positive duration like 15m", http.StatusBadRequest)
+		return
+	}
+
+	message, err := s.uc.SnoozeMessage(r.Context(), id, d)
+	writeUpdated(w, message, err)
+}
+
+// writeUpdated отвечает изменённым уведомлением или ошибкой изменения.
+func writeUpdated(w http.ResponseWriter, message domain.Message, err error) {
+	if errors.Is(err, domain.ErrMessageNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, domain.ErrNotPending) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(maskMessage(message))
+}
+
+// maskedHeaderValue заменяет значения webhook_headers в ответах API.
+const maskedHeaderValue = "***"
+
+// maskMessage скрывает значения webhook_headers: в них обычно лежат токены,
+// поэтому они только записываются через API и никогда не возвращаются.
+func maskMessage(message domain.Message) domain.Message {
+	message.WebhookHeaders = maskHeaders(message.WebhookHeaders)
+	return message
+}
+
+func maskHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	masked := make(map[string]string, len(headers))
+	for name := range headers {
+		masked[name] = maskedHeaderValue
+	}
+	return masked
+}
+
 func (s *Server) handleDeleteNotification(w http.ResponseWriter, r *http.Request, id string) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	if err := s.uc.DeleteMessage(r.Context(), id); err != nil {
+	err := s.uc.CancelMessage(r.Context(), id)
+	if errors.Is(err, domain.ErrMessageNotFound) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, domain.ErrInvalidTransition) {
+		// уже отправляется, доставлено или отменено
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
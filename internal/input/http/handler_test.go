@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,16 +18,36 @@ import (
 type usecasesMock struct {
 	createCalled bool
 	createdMsg   domain.Message
+	createErr    error
+	replayed     bool
 
 	listResult   []domain.Message
 	statusByID   map[string]string
-	deleteCalled bool
+	cancelCalled bool
+	cancelErr    error
+
+	attempts []domain.DeliveryAttempt
+
+	patch     domain.MessagePatch
+	snoozeFor time.Duration
+	updateErr error
+
+	occurrences   []time.Time
+	occurrencesTo time.Time
+
+	deadLetters  []domain.DeadLetter
+	dlqFilter    domain.DeadLetterFilter
+	replayIds    []int64
+	replayFilter *domain.DeadLetterFilter
 }
 
-func (u *usecasesMock) CreateAndSendMessage(ctx context.Context, message domain.Message) (string, error) {
+func (u *usecasesMock) CreateAndSendMessage(ctx context.Context, message domain.Message) (string, bool, error) {
 	u.createCalled = true
 	u.createdMsg = message
-	return "generated-id", nil
+	if u.createErr != nil {
+		return "", false, u.createErr
+	}
+	return "generated-id", u.replayed, nil
 }
 
 func (u *usecasesMock) GetMessageStatus(ctx context.Context, id string) (string, error) {
@@ -39,22 +61,68 @@ func (u *usecasesMock) ListMessages(ctx context.Context) ([]domain.Message, erro
 	return u.listResult, nil
 }
 
-func (u *usecasesMock) DeleteMessage(ctx context.Context, id string) error {
-	u.deleteCalled = true
-	return nil
+func (u *usecasesMock) ListOccurrences(ctx context.Context, id string, from, to time.Time) ([]time.Time, error) {
+	if id != "series" {
+		return nil, domain.ErrMessageNotFound
+	}
+	u.occurrencesTo = to
+	return u.occurrences, nil
+}
+
+func (u *usecasesMock) ListAttempts(ctx context.Context, id string) ([]domain.DeliveryAttempt, error) {
+	if id != "m1" {
+		return nil, domain.ErrMessageNotFound
+	}
+	return u.attempts, nil
+}
+
+func (u *usecasesMock) UpdateMessage(ctx context.Context, id string, patch domain.MessagePatch) (domain.Message, error) {
+	u.patch = patch
+	return domain.Message{Id: id}, u.updateErr
+}
+
+func (u *usecasesMock) SnoozeMessage(ctx context.Context, id string, d time.Duration) (domain.Message, error) {
+	u.snoozeFor = d
+	return domain.Message{Id: id}, u.updateErr
+}
+
+func (u *usecasesMock) CancelMessage(ctx context.Context, id string) error {
+	u.cancelCalled = true
+	return u.cancelErr
+}
+
+func (u *usecasesMock) ListDeadLetters(ctx context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error) {
+	u.dlqFilter = filter
+	return u.deadLetters, nil
+}
+
+func (u *usecasesMock) GetDeadLetter(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	for _, l := range u.deadLetters {
+		if l.Id == id {
+			return l, nil
+		}
+	}
+	return domain.DeadLetter{}, domain.ErrDeadLetterNotFound
+}
+
+func (u *usecasesMock) ReplayDeadLetters(ctx context.Context, ids []int64, filter *domain.DeadLetterFilter) (domain.ReplayResult, error) {
+	u.replayIds = ids
+	u.replayFilter = filter
+	return domain.ReplayResult{Replayed: ids}, nil
 }
 
 var _ port.Usecases = (*usecasesMock)(nil)
 
 func TestHandleCreateNotification_OK(t *testing.T) {
 	uc := &usecasesMock{}
-	srv := NewServer(uc)
+	srv := NewServer(uc, "")
 
 	body := map[string]any{
 		"text":             "hello",
 		"scheduled_at":     time.Now().Format(time.RFC3339),
 		"user_id":          1,
 		"telegram_chat_id": 42,
+		"channel":          "telegram",
 	}
 	data, _ := json.Marshal(body)
 
@@ -69,6 +137,9 @@ func TestHandleCreateNotification_OK(t *testing.T) {
 	if !uc.createCalled {
 		t.Fatalf("expected usecase CreateAndSendMessage to be called")
 	}
+	if uc.createdMsg.Channel != "telegram" {
+		t.Fatalf("expected channel to be passed to usecase, got %q", uc.createdMsg.Channel)
+	}
 
 	var resp map[string]string
 	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
@@ -79,7 +150,7 @@ func TestHandleCreateNotification_OK(t *testing.T) {
 
 func TestHandleCreateNotification_InvalidJSON(t *testing.T) {
 	uc := &usecasesMock{}
-	srv := NewServer(uc)
+	srv := NewServer(uc, "")
 
 	req := httptest.NewRequest(http.MethodPost, "/api/notifications", bytes.NewBufferString("{invalid-json"))
 	rec := httptest.NewRecorder()
@@ -94,6 +165,88 @@ func TestHandleCreateNotification_InvalidJSON(t *testing.T) {
 	}
 }
 
+func TestHandleCreateNotification_ScheduledLocal(t *testing.T) {
+	uc := &usecasesMock{}
+	srv := NewServer(uc, "")
+
+	body := map[string]any{
+		"text":            "hello",
+		"scheduled_local": "2030-06-01T09:00",
+		"timezone":        "Europe/Moscow",
+		"user_id":         1,
+	}
+	data, _ := json.Marshal(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/notifications", bytes.NewReader(data))
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	want := time.Date(2030, 6, 1, 6, 0, 0, 0, time.UTC)
+	if !uc.createdMsg.ScheduledAt.Equal(want) || uc.createdMsg.Timezone != "Europe/Moscow" {
+		t.Fatalf("expected %s in Europe/Moscow, got %s %q", want, uc.createdMsg.ScheduledAt, uc.createdMsg.Timezone)
+	}
+}
+
+func TestHandleCreateNotification_ScheduledLocalWithoutTimezone(t *testing.T) {
+	srv := NewServer(&usecasesMock{}, "")
+
+	data, _ := json.Marshal(map[string]any{"text": "hello", "scheduled_local": "2030-06-01T09:00", "user_id": 1})
+	req := httptest.NewRequest(http.MethodPost, "/api/notifications", bytes.NewReader(data))
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestHandleCreateNotification_IdempotencyKey(t *testing.T) {
+	uc := &usecasesMock{}
+	srv := NewServer(uc, "")
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/notifications", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "req-1")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(`{"text":"hi","user_id":1,"scheduled_at":"2030-01-01T00:00:00Z"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, rec.Code)
+	}
+	first := uc.createdMsg
+	if first.IdempotencyKey != "req-1" || first.RequestHash == "" {
+		t.Fatalf("expected key and request hash to be passed to usecase, got %q %q", first.IdempotencyKey, first.RequestHash)
+	}
+
+	// порядок полей и пробелы не меняют отпечаток; повтор отдаёт уже созданное уведомление
+	uc.replayed = true
+	uc.statusByID = map[string]string{"generated-id": domain.JobStatusScheduled}
+	rec := send(`{ "user_id": 1, "scheduled_at": "2030-01-01T00:00:00Z", "text": "hi" }`)
+	if uc.createdMsg.RequestHash != first.RequestHash {
+		t.Fatalf("expected equal hashes for equivalent bodies")
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d for replay, got %d", http.StatusOK, rec.Code)
+	}
+	var resp map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["id"] != "generated-id" || resp["status"] != domain.JobStatusScheduled {
+		t.Fatalf("expected original id and status in replay response, got %v", resp)
+	}
+
+	uc.createErr = domain.ErrIdempotencyConflict
+	if rec := send(`{"text":"bye","user_id":1,"scheduled_at":"2030-01-01T00:00:00Z"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, rec.Code)
+	}
+}
+
 func TestHandleListNotifications_OK(t *testing.T) {
 	uc := &usecasesMock{
 		listResult: []domain.Message{
@@ -101,7 +254,7 @@ func TestHandleListNotifications_OK(t *testing.T) {
 			{Id: "2", Text: "t2"},
 		},
 	}
-	srv := NewServer(uc)
+	srv := NewServer(uc, "")
 
 	req := httptest.NewRequest(http.MethodGet, "/api/notifications", nil)
 	rec := httptest.NewRecorder()
@@ -124,7 +277,7 @@ func TestHandleGetNotificationStatus_OK(t *testing.T) {
 	uc := &usecasesMock{
 		statusByID: map[string]string{"abc": "Scheduled"},
 	}
-	srv := NewServer(uc)
+	srv := NewServer(uc, "")
 
 	req := httptest.NewRequest(http.MethodGet, "/api/notifications/abc/status", nil)
 	rec := httptest.NewRecorder()
@@ -143,9 +296,9 @@ func TestHandleGetNotificationStatus_OK(t *testing.T) {
 	}
 }
 
-func TestHandleDeleteNotification_OK(t *testing.T) {
+func TestHandleCancelNotification_OK(t *testing.T) {
 	uc := &usecasesMock{}
-	srv := NewServer(uc)
+	srv := NewServer(uc, "")
 
 	req := httptest.NewRequest(http.MethodDelete, "/api/notifications/xyz", nil)
 	rec := httptest.NewRecorder()
@@ -155,8 +308,284 @@ func TestHandleDeleteNotification_OK(t *testing.T) {
 	if rec.Code != http.StatusNoContent {
 		t.Fatalf("expected 204, got %d", rec.Code)
 	}
-	if !uc.deleteCalled {
-		t.Fatalf("expected DeleteMessage to be called")
+	if !uc.cancelCalled {
+		t.Fatalf("expected CancelMessage to be called")
 	}
 }
 
+func TestHandleCancelNotification_AlreadySending(t *testing.T) {
+	uc := &usecasesMock{cancelErr: &domain.TransitionError{Id: "xyz", From: domain.JobStatusSending, To: domain.JobStatusCancelled}}
+	srv := NewServer(uc, "")
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/notifications/xyz", nil)
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestHandleListAttempts(t *testing.T) {
+	uc := &usecasesMock{attempts: []domain.DeliveryAttempt{
+		{MessageId: "m1", Attempt: 1, Outcome: domain.AttemptFailed, ErrorClass: domain.ErrorClassPermanent, ResponseCode: 403},
+	}}
+	srv := NewServer(uc, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/notifications/m1/attempts", nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp map[string][]domain.DeliveryAttempt
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if got := resp["attempts"]; len(got) != 1 || got[0].ResponseCode != 403 {
+		t.Fatalf("unexpected attempts %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/notifications/missing/attempts", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestHandleListNotifications_MasksWebhookHeaders(t *testing.T) {
+	uc := &usecasesMock{
+		listResult: []domain.Message{{Id: "1", WebhookHeaders: map[string]string{"Authorization": "Bearer secret"}}},
+	}
+	srv := NewServer(uc, "")
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/notifications", nil))
+
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Fatalf("webhook header values must not be returned, got %s", rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"webhook_headers":{"Authorization":"***"}`) {
+		t.Fatalf("expected masked header names, got %s", rec.Body.String())
+	}
+	if uc.listResult[0].WebhookHeaders["Authorization"] != "Bearer secret" {
+		t.Fatalf("masking must not modify the stored message")
+	}
+}
+
+func TestHandleUpdateNotification_OK(t *testing.T) {
+	uc := &usecasesMock{}
+	srv := NewServer(uc, "")
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/notifications/xyz", strings.NewReader(`{"text":"later","scheduled_at":"2030-01-01T10:00:00Z"}`))
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if uc.patch.Text == nil || *uc.patch.Text != "later" || uc.patch.Email != nil {
+		t.Fatalf("expected only passed fields in patch, got %+v", uc.patch)
+	}
+	if uc.patch.ScheduledAt == nil || !uc.patch.ScheduledAt.Equal(time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected scheduled_at in patch %v", uc.patch.ScheduledAt)
+	}
+}
+
+func TestHandleUpdateNotification_NotPending(t *testing.T) {
+	uc := &usecasesMock{updateErr: domain.ErrNotPending}
+	srv := NewServer(uc, "")
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/notifications/xyz", strings.NewReader(`{"text":"later"}`))
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestHandleSnoozeNotification(t *testing.T) {
+	uc := &usecasesMock{}
+	srv := NewServer(uc, "")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/notifications/xyz/snooze?for=15m", nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || uc.snoozeFor != 15*time.Minute {
+		t.Fatalf("expected snooze for 15m, got %d %s", rec.Code, uc.snoozeFor)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/notifications/xyz/snooze", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without duration, got %d", rec.Code)
+	}
+}
+
+func TestHandleListOccurrences_OK(t *testing.T) {
+	at := time.Date(2026, 3, 27, 9, 0, 0, 0, time.UTC)
+	uc := &usecasesMock{occurrences: []time.Time{at}}
+	srv := NewServer(uc, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/notifications/series/occurrences?from=2026-03-01T00:00:00Z&to=2026-04-01T00:00:00Z", nil)
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if !uc.occurrencesTo.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected to to be passed to usecase, got %s", uc.occurrencesTo)
+	}
+	var resp map[string][]time.Time
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(resp["occurrences"]) != 1 || !resp["occurrences"][0].Equal(at) {
+		t.Fatalf("unexpected occurrences %v", resp["occurrences"])
+	}
+}
+
+func TestHandleListOccurrences_NotFound(t *testing.T) {
+	srv := NewServer(&usecasesMock{}, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/notifications/missing/occurrences", nil)
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+const testAdminToken = "admin-secret"
+
+// adminRequest — запрос к admin‑эндпоинту с токеном.
+func adminRequest(method, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	return req
+}
+
+func TestAdminEndpoints_RequireToken(t *testing.T) {
+	uc := &usecasesMock{deadLetters: []domain.DeadLetter{{Id: 7, Payload: "{}"}}}
+	cases := []struct {
+		token  string
+		header string
+	}{
+		{testAdminToken, ""},
+		{testAdminToken, "Bearer wrong"},
+		// без настроенного токена DLQ закрыта
+		{"", "Bearer "},
+	}
+	for _, c := range cases {
+		srv := NewServer(uc, c.token)
+		for _, req := range []*http.Request{
+			httptest.NewRequest(http.MethodGet, "/api/admin/dlq", nil),
+			httptest.NewRequest(http.MethodGet, "/api/admin/dlq/7", nil),
+			httptest.NewRequest(http.MethodPost, "/api/admin/dlq/replay", strings.NewReader(`{"ids":[7]}`)),
+		} {
+			if c.header != "" {
+				req.Header.Set("Authorization", c.header)
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("expected 401 for %s %s with %q, got %d", req.Method, req.URL.Path, c.header, rec.Code)
+			}
+		}
+	}
+	if uc.replayIds != nil {
+		t.Fatalf("unauthorized replay must not reach the usecase")
+	}
+}
+
+func TestHandleListDeadLetters_Filter(t *testing.T) {
+	uc := &usecasesMock{}
+	srv := NewServer(uc, testAdminToken)
+
+	req := adminRequest(http.MethodGet, "/api/admin/dlq?reason=expired&since=2026-03-01T00:00:00Z&limit=10", nil)
+	rec := httptest.NewRecorder()
+
+	srv.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	f := uc.dlqFilter
+	if f.Reason != domain.DeadLetterExpired || f.Limit != 10 || !f.Since.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected filter %+v", f)
+	}
+	if !strings.Contains(rec.Body.String(), `"dead_letters":[]`) {
+		t.Fatalf("expected empty list, got %s", rec.Body.String())
+	}
+}
+
+func TestHandleGetDeadLetter(t *testing.T) {
+	uc := &usecasesMock{deadLetters: []domain.DeadLetter{{Id: 7, Reason: domain.DeadLetterUnparseable, Payload: "{broken"}}}
+	srv := NewServer(uc, testAdminToken)
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, adminRequest(http.MethodGet, "/api/admin/dlq/7", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"payload":"{broken"`) {
+		t.Fatalf("expected payload in response, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, adminRequest(http.MethodGet, "/api/admin/dlq/8", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestHandleGetDeadLetter_MasksWebhookHeaders(t *testing.T) {
+	payload := `{"id":"m1","webhook_url":"https://example.com","webhook_headers":{"X-Token":"secret"}}`
+	uc := &usecasesMock{deadLetters: []domain.DeadLetter{{Id: 7, Reason: domain.DeadLetterTerminallyFailed, Payload: payload}}}
+	srv := NewServer(uc, testAdminToken)
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, adminRequest(http.MethodGet, "/api/admin/dlq/7", nil))
+
+	var letter domain.DeadLetter
+	if err := json.Unmarshal(rec.Body.Bytes(), &letter); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if strings.Contains(letter.Payload, "secret") || !strings.Contains(letter.Payload, `"X-Token":"***"`) {
+		t.Fatalf("expected masked webhook headers in payload, got %s", letter.Payload)
+	}
+	if !strings.Contains(letter.Payload, `"webhook_url":"https://example.com"`) {
+		t.Fatalf("expected other payload fields to be kept, got %s", letter.Payload)
+	}
+}
+
+func TestHandleReplayDeadLetters(t *testing.T) {
+	uc := &usecasesMock{}
+	srv := NewServer(uc, testAdminToken)
+
+	body := `{"filter":{"reason":"terminally_failed","until":"2026-03-01T00:00:00Z"}}`
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, adminRequest(http.MethodPost, "/api/admin/dlq/replay", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if uc.replayFilter == nil || uc.replayFilter.Reason != domain.DeadLetterTerminallyFailed || uc.replayFilter.Until.IsZero() {
+		t.Fatalf("unexpected filter %+v", uc.replayFilter)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, adminRequest(http.MethodPost, "/api/admin/dlq/replay", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without ids and filter, got %d", rec.Code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/fs"
 	"net/http"
 
+	"github.com/dontpanicw/DelayedNotifier/internal/admin"
 	"github.com/dontpanicw/DelayedNotifier/internal/port"
 )
 
@@ -16,7 +17,9 @@ type Server struct {
 	mux *http.ServeMux
 }
 
-func NewServer(uc port.Usecases) *Server {
+// NewServer собирает маршруты API. Admin‑эндпоинты DLQ требуют
+// "Authorization: Bearer <adminToken>"; с пустым adminToken они всегда отвечают 401.
+func NewServer(uc port.Usecases, adminToken string) *Server {
 	s := &Server{uc: uc, mux: http.NewServeMux()}
 
 	s.mux.HandleFunc("POST /api/notifications", s.handleCreateNotification)
@@ -24,10 +27,29 @@ func NewServer(uc port.Usecases) *Server {
 	s.mux.HandleFunc("GET /api/notifications/{id}/status", func(w http.ResponseWriter, r *http.Request) {
 		s.handleGetNotificationStatus(w, r, r.PathValue("id"))
 	})
+	s.mux.HandleFunc("GET /api/notifications/{id}/occurrences", func(w http.ResponseWriter, r *http.Request) {
+		s.handleListOccurrences(w, r, r.PathValue("id"))
+	})
+	s.mux.HandleFunc("GET /api/notifications/{id}/attempts", func(w http.ResponseWriter, r *http.Request) {
+		s.handleListAttempts(w, r, r.PathValue("id"))
+	})
+	s.mux.HandleFunc("PATCH /api/notifications/{id}", func(w http.ResponseWriter, r *http.Request) {
+		s.handleUpdateNotification(w, r, r.PathValue("id"))
+	})
+	s.mux.HandleFunc("POST /api/notifications/{id}/snooze", func(w http.ResponseWriter, r *http.Request) {
+		s.handleSnoozeNotification(w, r, r.PathValue("id"))
+	})
 	s.mux.HandleFunc("DELETE /api/notifications/{id}", func(w http.ResponseWriter, r *http.Request) {
 		s.handleDeleteNotification(w, r, r.PathValue("id"))
 	})
 
+	// в DLQ лежат тела уведомлений с заголовками вебхуков, а replay массово возвращает их в доставку
+	s.mux.Handle("GET /api/admin/dlq", admin.RequireToken(adminToken, http.HandlerFunc(s.handleListDeadLetters)))
+	s.mux.Handle("GET /api/admin/dlq/{id}", admin.RequireToken(adminToken, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.handleGetDeadLetter(w, r, r.PathValue("id"))
+	})))
+	s.mux.Handle("POST /api/admin/dlq/replay", admin.RequireToken(adminToken, http.HandlerFunc(s.handleReplayDeadLetters)))
+
 	dist, _ := fs.Sub(staticFS, "static")
 	s.mux.Handle("/", http.FileServer(http.FS(dist)))
 
@@ -4,17 +4,33 @@ const emptyEl = document.getElementById('empty');
 const form = document.getElementById('form');
 const formError = document.getElementById('form-error');
 const submitBtn = document.getElementById('submit-btn');
+const channelFields = {
+  telegram: document.getElementById('telegram-fields'),
+  email: document.getElementById('email-fields'),
+  webhook: document.getElementById('webhook-fields')
+};
+
+function showChannelFields() {
+  Object.entries(channelFields).forEach(([name, el]) => {
+    el.style.display = form.channel.value === name ? 'block' : 'none';
+  });
+}
+
+form.channel.addEventListener('change', showChannelFields);
+form.timezone.value = Intl.DateTimeFormat().resolvedOptions().timeZone || '';
 
 function setFormError(msg) {
   formError.textContent = msg || '';
   formError.style.display = msg ? 'block' : 'none';
 }
 
-function formatDate(iso) {
+function formatDate(iso, timeZone) {
   if (!iso) return '—';
   try {
     const d = new Date(iso);
-    return d.toLocaleString('ru-RU', { dateStyle: 'short', timeStyle: 'short' });
+    const opts = { dateStyle: 'short', timeStyle: 'short' };
+    if (timeZone) opts.timeZone = timeZone;
+    return d.toLocaleString('ru-RU', opts) + (timeZone ? ' ' + timeZone : '');
   } catch (_) {
     return iso;
   }
@@ -25,6 +41,12 @@ function statusClass(s) {
   return 'status-' + (s.replace(/\s+/g, '_'));
 }
 
+function recipient(m) {
+  if (m.channel === 'email') return 'email: ' + escapeHtml(m.email || '—');
+  if (m.channel === 'webhook') return 'url: ' + escapeHtml(m.webhook_url || '—');
+  return 'chat_id: ' + (m.telegram_chat_id ?? '—');
+}
+
 function renderItem(m) {
   const li = document.createElement('li');
   li.innerHTML = `
@@ -32,7 +54,7 @@ function renderItem(m) {
       <div class="notif-text">${escapeHtml(m.text || '')}</div>
       <div class="notif-meta">
         <span class="notif-id">${escapeHtml(m.id || '')}</span><br>
-        ${formatDate(m.scheduled_at)} · user_id: ${m.user_id ?? '—'} · chat_id: ${m.telegram_chat_id ?? '—'}
+        ${escapeHtml(formatDate(m.scheduled_at, m.timezone))}${m.cron ? ' · cron: ' + escapeHtml(m.cron) : ''}${m.occurrence ? ' · #' + m.occurrence : ''} · user_id: ${m.user_id ?? '—'} · ${escapeHtml(m.channel || 'telegram')} · ${recipient(m)}
       </div>
     </div>
     <span class="status ${statusClass(m.status)}">${escapeHtml(m.status || '')}</span>
@@ -82,22 +104,53 @@ form.addEventListener('submit', async (e) => {
   const text = form.text.value.trim();
   const scheduledAt = form.scheduled_at.value;
   const userId = parseInt(form.user_id.value, 10);
-  const telegramChatId = parseInt(form.telegram_chat_id.value, 10);
+  const channel = form.channel.value;
+  const cron = form.cron.value.trim();
+  const timezone = form.timezone.value.trim();
   const body = {
     text,
-    scheduled_at: scheduledAt ? new Date(scheduledAt).toISOString() : null,
     user_id: userId,
-    telegram_chat_id: telegramChatId
+    channel
   };
-  if (!body.scheduled_at) {
+  if (timezone) body.timezone = timezone;
+  if (scheduledAt) {
+    // время из формы — по часам получателя, в UTC его переводит сервер
+    if (timezone) body.scheduled_local = scheduledAt;
+    else body.scheduled_at = new Date(scheduledAt).toISOString();
+  }
+  if (cron) body.cron = cron;
+  if (channel === 'email') {
+    body.email = form.email.value.trim();
+  } else if (channel === 'webhook') {
+    body.webhook_url = form.webhook_url.value.trim();
+    const raw = form.webhook_body.value.trim();
+    if (raw) {
+      try {
+        body.webhook_body = JSON.parse(raw);
+      } catch (_) {
+        setFormError('Тело вебхука должно быть корректным JSON');
+        submitBtn.classList.remove('loading');
+        return;
+      }
+    }
+  } else {
+    body.telegram_chat_id = parseInt(form.telegram_chat_id.value, 10);
+  }
+  if (!scheduledAt && !cron) {
     setFormError('Укажите время отправки');
     submitBtn.classList.remove('loading');
     return;
   }
   try {
+    const headers = { 'Content-Type': 'application/json' };
+    // повторная отправка той же формы (двойной клик, ретрай) не создаст дубль
+    if (window.crypto && crypto.randomUUID) {
+      form.dataset.idempotencyKey = form.dataset.idempotencyKey || crypto.randomUUID();
+      headers['Idempotency-Key'] = form.dataset.idempotencyKey;
+    }
     const res = await fetch(API, {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers,
       body: JSON.stringify(body)
     });
     if (!res.ok) {
@@ -105,8 +158,10 @@ form.addEventListener('submit', async (e) => {
       setFormError(text || res.statusText || 'Ошибка создания');
       return;
     }
+    delete form.dataset.idempotencyKey;
     form.text.value = '';
     form.scheduled_at.value = '';
+    form.cron.value = '';
     loadList();
   } catch (err) {
     setFormError(err.message || 'Ошибка сети');
@@ -0,0 +1,10 @@
+package port
+
+import "context"
+
+// CancelBus рассылает отмены уведомлений, чтобы воркеры сразу прекращали ожидание их срока.
+type CancelBus interface {
+	PublishCancel(ctx context.Context, id string) error
+	// SubscribeCancel возвращает канал id отменённых уведомлений; канал закрывается вместе с ctx.
+	SubscribeCancel(ctx context.Context) (<-chan string, error)
+}
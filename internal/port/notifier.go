@@ -0,0 +1,16 @@
+package port
+
+import (
+	"context"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+// Notifier доставляет сообщение получателю через конкретный канал
+// (Telegram, email, webhook и т.д.).
+type Notifier interface {
+	// Channel возвращает имя канала, под которым notifier регистрируется в реестре.
+	Channel() string
+	// Send возвращает nil только после подтверждённой доставки.
+	Send(ctx context.Context, message domain.Message) error
+}
@@ -0,0 +1,14 @@
+package port
+
+import (
+	"context"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+// Recurrence планирует следующие вхождения повторяющихся уведомлений.
+type Recurrence interface {
+	// ScheduleNext создаёт и ставит в очередь вхождение, следующее за occurrence.
+	// Если серия отменена или исчерпана, ничего не планирует.
+	ScheduleNext(ctx context.Context, occurrence domain.Message) error
+}
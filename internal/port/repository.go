@@ -2,13 +2,64 @@ package port
 
 import (
 	"context"
+	"time"
+
 	"github.com/dontpanicw/DelayedNotifier/internal/domain"
 )
 
 type Repository interface {
 	CreateMessage(ctx context.Context, message domain.Message) error
+	// CreateSeries атомарно сохраняет родителя серии и её первое вхождение
+	// (в режиме outbox — вместе с его записью outbox).
+	CreateSeries(ctx context.Context, parent, first domain.Message) error
 	GetMessageStatus(ctx context.Context, id string) (string, error)
+	GetMessage(ctx context.Context, id string) (domain.Message, error)
+	GetMessageByIdempotencyKey(ctx context.Context, userID uint32, key string) (domain.Message, error)
 	ListMessages(ctx context.Context) ([]domain.Message, error)
 	UpdateMessageStatus(ctx context.Context, id, status string) error
-	DeleteMessage(ctx context.Context, id string) error
+	// UpdatePendingMessage сохраняет текст, срок, зону и получателя ещё ожидающего
+	// сообщения, возвращает его в Scheduled и возвращает новую ревизию.
+	// Ошибка с domain.ErrNotPending — сообщение уже отправляется или обработано.
+	UpdatePendingMessage(ctx context.Context, message domain.Message) (int, error)
+	// CancelMessage отменяет сообщение, а для серии — и её ожидающие вхождения.
+	// Возвращает id отменённых строк; *domain.TransitionError — отменять уже поздно.
+	CancelMessage(ctx context.Context, id string) ([]string, error)
+	// DispatchDueMessages передаёт в dispatch до limit наступивших Scheduled-сообщений
+	// и переводит переданные в Queued. Возвращает число переданных.
+	DispatchDueMessages(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error)
+	// DispatchOutbox передаёт в dispatch до limit сообщений, ожидающих публикации
+	// в outbox, и отмечает переданные. Возвращает число переданных.
+	DispatchOutbox(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error)
+	// ClaimMessage атомарно переводит сообщение ревизии revision в Sending на время lease
+	// и возвращает номер начатой попытки. 0 — сообщение уже доставлено, отменено,
+	// изменено или захвачено другим воркером.
+	ClaimMessage(ctx context.Context, id string, revision int, lease time.Duration) (int, error)
+	// ScheduleRetry переводит доставляемое сообщение в Failed с повторной попыткой в at.
+	ScheduleRetry(ctx context.Context, id string, at time.Time) error
+	// ReleaseExpiredLeases возвращает к доставке сообщения, захват которых истёк
+	// (воркер упал посреди отправки), и возвращает их число.
+	ReleaseExpiredLeases(ctx context.Context) (int, error)
+	// ReleaseLease возвращает в Scheduled сообщение, доставку которого прервала
+	// остановка воркера, не дожидаясь истечения захвата.
+	ReleaseLease(ctx context.Context, id string) error
+	// RecordAttempt сохраняет попытку доставки и возвращает её сквозной номер.
+	RecordAttempt(ctx context.Context, attempt domain.DeliveryAttempt) (int, error)
+	// ListAttempts возвращает историю попыток доставки сообщения по порядку.
+	ListAttempts(ctx context.Context, messageID string) ([]domain.DeliveryAttempt, error)
+	// RecordDeadLetter сохраняет сообщение из DLQ с причиной.
+	RecordDeadLetter(ctx context.Context, letter domain.DeadLetter) error
+	// ListDeadLetters возвращает записи DLQ по фильтру, новые первыми, без тела.
+	ListDeadLetters(ctx context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error)
+	GetDeadLetter(ctx context.Context, id int64) (domain.DeadLetter, error)
+	// ReplayDeadLetter возвращает сообщение записи DLQ в Scheduled с новым бюджетом
+	// попыток и возвращает его id. Ошибка с domain.ErrNotReplayable — повторять нечего.
+	ReplayDeadLetter(ctx context.Context, id int64) (string, error)
+	// MarkLostMessages переводит в Lost сообщения в статусах statuses, которые
+	// не обработаны дольше grace после срока, и возвращает их.
+	MarkLostMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error)
+	// RequeueOverdueMessages возвращает в Scheduled с новой ревизией те же сообщения,
+	// что нашёл бы MarkLostMessages, чтобы их опубликовали заново, и возвращает их.
+	RequeueOverdueMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error)
+	// ListOverdueMessages возвращает те же сообщения, ничего не меняя.
+	ListOverdueMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error)
 }
@@ -3,11 +3,21 @@ package port
 import (
 	"context"
 	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"time"
 )
 
 type Usecases interface {
-	CreateAndSendMessage(ctx context.Context, message domain.Message) (string, error)
+	// CreateAndSendMessage возвращает id уведомления; replayed — ключ идемпотентности
+	// совпал с уже созданным, и возвращён его id.
+	CreateAndSendMessage(ctx context.Context, message domain.Message) (id string, replayed bool, err error)
 	GetMessageStatus(ctx context.Context, id string) (string, error)
 	ListMessages(ctx context.Context) ([]domain.Message, error)
-	DeleteMessage(ctx context.Context, id string) error
+	ListOccurrences(ctx context.Context, id string, from, to time.Time) ([]time.Time, error)
+	ListAttempts(ctx context.Context, id string) ([]domain.DeliveryAttempt, error)
+	UpdateMessage(ctx context.Context, id string, patch domain.MessagePatch) (domain.Message, error)
+	SnoozeMessage(ctx context.Context, id string, d time.Duration) (domain.Message, error)
+	CancelMessage(ctx context.Context, id string) error
+	ListDeadLetters(ctx context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error)
+	GetDeadLetter(ctx context.Context, id int64) (domain.DeadLetter, error)
+	ReplayDeadLetters(ctx context.Context, ids []int64, filter *domain.DeadLetterFilter) (domain.ReplayResult, error)
 }
@@ -0,0 +1,73 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+const (
+	// defaultDeadLetterLimit — размер выборки DLQ, если лимит не передан.
+	defaultDeadLetterLimit = 100
+	maxDeadLetterLimit     = 1000
+)
+
+// ListDeadLetters возвращает записи DLQ по фильтру, новые первыми.
+func (m *MessageUsecases) ListDeadLetters(ctx context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error) {
+	filter.Limit = deadLetterLimit(filter.Limit)
+	return m.repo.ListDeadLetters(ctx, filter)
+}
+
+// GetDeadLetter возвращает запись DLQ вместе с исходным телом сообщения.
+func (m *MessageUsecases) GetDeadLetter(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	return m.repo.GetDeadLetter(ctx, id)
+}
+
+// ReplayDeadLetters возвращает в доставку сообщения выбранных записей DLQ: по ids либо,
+// если их нет, ещё не повторённые записи, подходящие под filter. Сообщение снова
+// проходит планировщик (или relay outbox) с полным бюджетом попыток своей политики.
+// Записи, которые повторить нельзя, попадают в Skipped и не прерывают остальные.
+func (m *MessageUsecases) ReplayDeadLetters(ctx context.Context, ids []int64, filter *domain.DeadLetterFilter) (domain.ReplayResult, error) {
+	if len(ids) == 0 {
+		if filter == nil {
+			return domain.ReplayResult{}, errors.New("ids or filter is required")
+		}
+		f := *filter
+		f.Replayed = false
+		letters, err := m.ListDeadLetters(ctx, f)
+		if err != nil {
+			return domain.ReplayResult{}, err
+		}
+		for _, letter := range letters {
+			ids = append(ids, letter.Id)
+		}
+	}
+
+	result := domain.ReplayResult{Replayed: []int64{}, Skipped: []domain.ReplaySkip{}}
+	for _, id := range ids {
+		messageID, err := m.repo.ReplayDeadLetter(ctx, id)
+		if errors.Is(err, domain.ErrNotReplayable) || errors.Is(err, domain.ErrDeadLetterNotFound) {
+			result.Skipped = append(result.Skipped, domain.ReplaySkip{Id: id, Error: err.Error()})
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if m.cache != nil {
+			_ = m.cache.SetStatus(ctx, messageID, domain.JobStatusScheduled, 5*time.Minute)
+		}
+		log.Printf("dead letter %d replayed, message %s rescheduled", id, messageID)
+		result.Replayed = append(result.Replayed, id)
+	}
+	return result, nil
+}
+
+func deadLetterLimit(limit int) int {
+	if limit <= 0 {
+		return defaultDeadLetterLimit
+	}
+	return min(limit, maxDeadLetterLimit)
+}
@@ -2,8 +2,12 @@ package usecases
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"net/mail"
+	"net/url"
 	"time"
 
 	"github.com/dontpanicw/DelayedNotifier/internal/domain"
@@ -15,35 +19,99 @@ var _ port.Usecases = (*MessageUsecases)(nil)
 
 type MessageUsecases struct {
 	repo  port.Repository
-	queue port.MessageQueue
+	queue port.MessageQueue // nil, если публикацией занимается планировщик или relay outbox
 	cache port.StatusCache
+	// cancels — оповещение воркеров об отменах; nil — отмену заметит только захват
+	cancels port.CancelBus
+	// policies — известные политики повторов: сообщение может выбрать одну из них
+	policies domain.RetryPolicies
 }
 
-func NewMessageUsecases(repo port.Repository, queue port.MessageQueue, cache port.StatusCache) *MessageUsecases {
+func NewMessageUsecases(repo port.Repository, queue port.MessageQueue, cache port.StatusCache, cancels port.CancelBus, policies domain.RetryPolicies) *MessageUsecases {
 	return &MessageUsecases{
-		repo:  repo,
-		queue: queue,
-		cache: cache,
+		repo:     repo,
+		queue:    queue,
+		cache:    cache,
+		cancels:  cancels,
+		policies: policies,
 	}
 }
 
-func (m *MessageUsecases) CreateAndSendMessage(ctx context.Context, message domain.Message) (string, error) {
+func (m *MessageUsecases) CreateAndSendMessage(ctx context.Context, message domain.Message) (string, bool, error) {
 	if message.UserId <= 0 {
-		return "", errors.New("userId should be greater than zero")
+		return "", false, errors.New("userId should be greater than zero")
+	}
+	if message.Channel == "" {
+		message.Channel = domain.DefaultChannel
+	}
+	if err := validateDelivery(&message); err != nil {
+		return "", false, err
+	}
+	if message.RetryPolicy != "" && !m.policies.Has(message.RetryPolicy) {
+		return "", false, fmt.Errorf("unknown retry_policy %q", message.RetryPolicy)
+	}
+	if message.Priority == "" {
+		message.Priority = domain.DefaultPriority
+	}
+	if _, ok := domain.PriorityLevel(message.Priority); !ok {
+		return "", false, fmt.Errorf("unknown priority %q", message.Priority)
+	}
+	if message.IdempotencyKey != "" {
+		id, err := m.replay(ctx, message)
+		if !errors.Is(err, domain.ErrMessageNotFound) {
+			return id, err == nil, err
+		}
+	}
+	if message.IsRecurring() {
+		return m.createRecurring(ctx, message)
 	}
 	message.Id = uuid.NewString()
 	message.Status = domain.JobStatusScheduled
 	err := m.repo.CreateMessage(ctx, message)
 	if err != nil {
-		return "", err
+		return m.resolveDuplicate(ctx, message, err)
+	}
+	if err := m.enqueue(ctx, message); err != nil {
+		return "", false, err
 	}
-	//TODO: отправить в rabbitmq
-	err = m.queue.SendMessage(ctx, message)
+	log.Printf("message %s scheduled", message.Id)
+	return message.Id, false, nil
+}
+
+// replay возвращает id уведомления, ранее созданного с тем же ключом идемпотентности.
+// ErrMessageNotFound — ключ свободен (или срок его хранения истёк).
+func (m *MessageUsecases) replay(ctx context.Context, message domain.Message) (string, error) {
+	existing, err := m.repo.GetMessageByIdempotencyKey(ctx, message.UserId, message.IdempotencyKey)
 	if err != nil {
 		return "", err
 	}
-	log.Printf("message %s sent", message.Id)
-	return message.Id, nil
+	if existing.RequestHash != message.RequestHash {
+		return "", domain.ErrIdempotencyConflict
+	}
+	log.Printf("idempotent replay of message %s", existing.Id)
+	return existing.Id, nil
+}
+
+// resolveDuplicate разбирает ошибку создания: если параллельный запрос с тем же ключом
+// успел раньше, возвращается его результат.
+func (m *MessageUsecases) resolveDuplicate(ctx context.Context, message domain.Message, err error) (string, bool, error) {
+	if message.IdempotencyKey == "" || !errors.Is(err, domain.ErrMessageExists) {
+		return "", false, err
+	}
+	id, replayErr := m.replay(ctx, message)
+	if errors.Is(replayErr, domain.ErrMessageNotFound) {
+		return "", false, err
+	}
+	return id, replayErr == nil, replayErr
+}
+
+// enqueue публикует сообщение сразу после создания. Без очереди сообщение остаётся в БД:
+// его опубликует планировщик воркера, когда наступит срок, или relay outbox.
+func (m *MessageUsecases) enqueue(ctx context.Context, message domain.Message) error {
+	if m.queue == nil {
+		return nil
+	}
+	return m.queue.SendMessage(ctx, message)
 }
 
 func (m *MessageUsecases) GetMessageStatus(ctx context.Context, id string) (string, error) {
@@ -63,10 +131,180 @@ func (m *MessageUsecases) GetMessageStatus(ctx context.Context, id string) (stri
 	return messageStatus, nil
 }
 
+// ListMessages возвращает уведомления со временем в зоне получателя.
 func (m *MessageUsecases) ListMessages(ctx context.Context) ([]domain.Message, error) {
-	return m.repo.ListMessages(ctx)
+	messages, err := m.repo.ListMessages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i] = localize(messages[i])
+	}
+	return messages, nil
+}
+
+// ListOccurrences возвращает моменты срабатывания уведомления в диапазоне [from, to].
+func (m *MessageUsecases) ListOccurrences(ctx context.Context, id string, from, to time.Time) ([]time.Time, error) {
+	if to.Before(from) {
+		return nil, errors.New("to must not be before from")
+	}
+	message, err := m.repo.GetMessage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !message.IsRecurring() {
+		if message.ScheduledAt.Before(from) || message.ScheduledAt.After(to) {
+			return []time.Time{}, nil
+		}
+		return []time.Time{message.ScheduledAt.In(message.Location())}, nil
+	}
+	return previewOccurrences(message, from, to)
+}
+
+// ListAttempts возвращает историю попыток доставки уведомления.
+func (m *MessageUsecases) ListAttempts(ctx context.Context, id string) ([]domain.DeliveryAttempt, error) {
+	if _, err := m.repo.GetMessage(ctx, id); err != nil {
+		return nil, err
+	}
+	return m.repo.ListAttempts(ctx, id)
+}
+
+// UpdateMessage меняет текст, срок или получателя ещё ожидающего уведомления.
+// Сообщение получает новую ревизию и публикуется заново, а копию, которую воркер уже
+// держит (в очереди, бакете ожидания или на таймере), он отбросит при захвате.
+func (m *MessageUsecases) UpdateMessage(ctx context.Context, id string, patch domain.MessagePatch) (domain.Message, error) {
+	message, err := m.repo.GetMessage(ctx, id)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	if !domain.IsPending(message.Status) {
+		// серия (Recurring) тоже сюда: её вхождения меняются по отдельности
+		return domain.Message{}, fmt.Errorf("%w: message %s is %s", domain.ErrNotPending, id, message.Status)
+	}
+	patch.Apply(&message)
+	if err := validateDelivery(&message); err != nil {
+		return domain.Message{}, err
+	}
+
+	revision, err := m.repo.UpdatePendingMessage(ctx, message)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	message.Revision = revision
+	message.Status = domain.JobStatusScheduled
+	if m.cache != nil {
+		_ = m.cache.SetStatus(ctx, id, message.Status, 5*time.Minute)
+	}
+	if err := m.enqueue(ctx, message); err != nil {
+		return domain.Message{}, err
+	}
+	log.Printf("message %s rescheduled to %s (revision %d)", id, message.ScheduledAt, revision)
+	return localize(message), nil
+}
+
+// SnoozeMessage откладывает ожидающее уведомление на d от его срока,
+// а если срок уже наступил — от текущего момента.
+func (m *MessageUsecases) SnoozeMessage(ctx context.Context, id string, d time.Duration) (domain.Message, error) {
+	if d <= 0 {
+		return domain.Message{}, errors.New("snooze duration should be positive")
+	}
+	message, err := m.repo.GetMessage(ctx, id)
+	if err != nil {
+		return domain.Message{}, err
+	}
+	at := message.ScheduledAt
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	at = at.Add(d)
+	return m.UpdateMessage(ctx, id, domain.MessagePatch{ScheduledAt: &at})
+}
+
+// CancelMessage отменяет уведомление или серию. Строка остаётся в БД со статусом Cancelled,
+// а ожидающие её срока воркеры получают отмену и подтверждают сообщение без отправки.
+// Отмена вхождения пропускает только его: серия продолжается следующим.
+func (m *MessageUsecases) CancelMessage(ctx context.Context, id string) error {
+	ids, err := m.repo.CancelMessage(ctx, id)
+	if err != nil {
+		return err
+	}
+	m.skipOccurrence(ctx, id)
+	for _, cancelled := range ids {
+		if m.cache != nil {
+			_ = m.cache.SetStatus(ctx, cancelled, domain.JobStatusCancelled, 5*time.Minute)
+		}
+		if m.cancels == nil {
+			continue
+		}
+		// без рассылки отмена всё равно сработает: воркер не сможет захватить сообщение
+		if err := m.cancels.PublishCancel(ctx, cancelled); err != nil {
+			log.Printf("failed to broadcast cancellation of message %s: %v", cancelled, err)
+		}
+	}
+	log.Printf("message %s cancelled", id)
+	return nil
 }
 
-func (m *MessageUsecases) DeleteMessage(ctx context.Context, id string) error {
-	return m.repo.DeleteMessage(ctx, id)
+// skipOccurrence планирует следующее вхождение вместо отменённого: иначе воркер,
+// который обычно это делает после отправки, до него не дойдёт, и серия встанет.
+func (m *MessageUsecases) skipOccurrence(ctx context.Context, id string) {
+	message, err := m.repo.GetMessage(ctx, id)
+	if err != nil {
+		log.Printf("failed to load cancelled message %s: %v", id, err)
+		return
+	}
+	if message.ParentId == "" {
+		return
+	}
+	if err := NewRecurrenceUsecases(m.repo, m.queue).ScheduleNext(ctx, message); err != nil {
+		log.Printf("failed to schedule next occurrence after cancelled %s: %v", id, err)
+	}
+}
+
+// localize переводит времена сообщения в зону получателя.
+func localize(message domain.Message) domain.Message {
+	loc := message.Location()
+	message.ScheduledAt = message.ScheduledAt.In(loc)
+	if message.RepeatUntil != nil {
+		until := message.RepeatUntil.In(loc)
+		message.RepeatUntil = &until
+	}
+	return message
+}
+
+// validateDelivery проверяет канал, получателя и зону сообщения. Email сохраняется
+// голым адресом: "Bob <bob@x.com>" превратился бы в некорректные RCPT TO и To:.
+func validateDelivery(message *domain.Message) error {
+	if !domain.IsKnownChannel(message.Channel) {
+		return fmt.Errorf("unknown channel %q", message.Channel)
+	}
+	if message.Channel == domain.ChannelEmail {
+		addr, err := mail.ParseAddress(message.Email)
+		if err != nil {
+			return errors.New("valid email is required for email channel")
+		}
+		message.Email = addr.Address
+	}
+	if message.Channel == domain.ChannelWebhook {
+		if err := validateWebhook(*message); err != nil {
+			return err
+		}
+	}
+	if message.Timezone != "" {
+		if _, err := time.LoadLocation(message.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", message.Timezone)
+		}
+	}
+	return nil
+}
+
+func validateWebhook(message domain.Message) error {
+	u, err := url.Parse(message.WebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("valid http(s) webhook_url is required for webhook channel")
+	}
+	if len(message.WebhookBody) > 0 && !json.Valid(message.WebhookBody) {
+		return errors.New("webhook_body must be valid JSON")
+	}
+	return nil
 }
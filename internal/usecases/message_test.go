@@ -3,6 +3,7 @@ package usecases
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -12,16 +13,61 @@ import (
 type repoMock struct {
 	createCalled bool
 	createdMsg   domain.Message
+	created      []domain.Message
+	seriesErr    error
 
-	statusByID map[string]string
+	statusByID  map[string]string
+	messageByID map[string]domain.Message
+	attempts    []domain.DeliveryAttempt
+	deadLetters []domain.DeadLetter
 }
 
 func (r *repoMock) CreateMessage(ctx context.Context, message domain.Message) error {
+	for _, m := range r.created {
+		if m.Id == message.Id {
+			return domain.ErrMessageExists
+		}
+		if message.IdempotencyKey != "" && m.UserId == message.UserId && m.IdempotencyKey == message.IdempotencyKey {
+			return domain.ErrMessageExists
+		}
+	}
 	r.createCalled = true
 	r.createdMsg = message
+	r.created = append(r.created, message)
+	return nil
+}
+
+func (r *repoMock) CreateSeries(ctx context.Context, parent, first domain.Message) error {
+	if r.seriesErr != nil {
+		return r.seriesErr
+	}
+	created := r.created
+	if err := r.CreateMessage(ctx, parent); err != nil {
+		return err
+	}
+	if err := r.CreateMessage(ctx, first); err != nil {
+		r.created = created // откат, как у транзакции
+		return err
+	}
 	return nil
 }
 
+func (r *repoMock) GetMessage(ctx context.Context, id string) (domain.Message, error) {
+	if m, ok := r.messageByID[id]; ok {
+		return m, nil
+	}
+	return domain.Message{}, domain.ErrMessageNotFound
+}
+
+func (r *repoMock) GetMessageByIdempotencyKey(ctx context.Context, userID uint32, key string) (domain.Message, error) {
+	for _, m := range r.created {
+		if m.UserId == userID && m.IdempotencyKey == key {
+			return m, nil
+		}
+	}
+	return domain.Message{}, domain.ErrMessageNotFound
+}
+
 func (r *repoMock) GetMessageStatus(ctx context.Context, id string) (string, error) {
 	if s, ok := r.statusByID[id]; ok {
 		return s, nil
@@ -37,14 +83,138 @@ func (r *repoMock) UpdateMessageStatus(ctx context.Context, id, status string) e
 	if r.statusByID == nil {
 		r.statusByID = make(map[string]string)
 	}
+	if from, ok := r.statusByID[id]; ok && !domain.CanTransition(from, status) {
+		return &domain.TransitionError{Id: id, From: from, To: status}
+	}
 	r.statusByID[id] = status
 	return nil
 }
 
-func (r *repoMock) DeleteMessage(ctx context.Context, id string) error {
+func (r *repoMock) RecordAttempt(ctx context.Context, attempt domain.DeliveryAttempt) (int, error) {
+	r.attempts = append(r.attempts, attempt)
+	return len(r.attempts), nil
+}
+
+func (r *repoMock) ListAttempts(ctx context.Context, messageID string) ([]domain.DeliveryAttempt, error) {
+	var res []domain.DeliveryAttempt
+	for _, a := range r.attempts {
+		if a.MessageId == messageID {
+			res = append(res, a)
+		}
+	}
+	return res, nil
+}
+
+func (r *repoMock) UpdatePendingMessage(ctx context.Context, message domain.Message) (int, error) {
+	stored, ok := r.messageByID[message.Id]
+	if !ok {
+		return 0, domain.ErrMessageNotFound
+	}
+	status := stored.Status
+	if s, ok := r.statusByID[message.Id]; ok {
+		status = s
+	}
+	if !domain.IsPending(status) {
+		return 0, fmt.Errorf("%w: message %s is %s", domain.ErrNotPending, message.Id, status)
+	}
+	message.Status = domain.JobStatusScheduled
+	message.Revision = stored.Revision + 1
+	r.messageByID[message.Id] = message
+	return message.Revision, nil
+}
+
+func (r *repoMock) CancelMessage(ctx context.Context, id string) ([]string, error) {
+	if err := r.UpdateMessageStatus(ctx, id, domain.JobStatusCancelled); err != nil {
+		return nil, err
+	}
+	ids := []string{id}
+	for _, m := range r.created {
+		status, ok := r.statusByID[m.Id]
+		if !ok {
+			status = m.Status
+		}
+		if m.ParentId == id && domain.CanTransition(status, domain.JobStatusCancelled) {
+			r.statusByID[m.Id] = domain.JobStatusCancelled
+			ids = append(ids, m.Id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *repoMock) DispatchDueMessages(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error) {
+	return 0, nil
+}
+
+func (r *repoMock) DispatchOutbox(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error) {
+	return 0, nil
+}
+
+func (r *repoMock) ClaimMessage(ctx context.Context, id string, revision int, lease time.Duration) (int, error) {
+	return 1, nil
+}
+
+func (r *repoMock) ScheduleRetry(ctx context.Context, id string, at time.Time) error {
+	return r.UpdateMessageStatus(ctx, id, domain.JobStatusFailed)
+}
+
+func (r *repoMock) ReleaseExpiredLeases(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+func (r *repoMock) RecordDeadLetter(ctx context.Context, letter domain.DeadLetter) error {
+	r.deadLetters = append(r.deadLetters, letter)
+	return nil
+}
+
+func (r *repoMock) ListDeadLetters(ctx context.Context, filter domain.DeadLetterFilter) ([]domain.DeadLetter, error) {
+	var res []domain.DeadLetter
+	for _, l := range r.deadLetters {
+		if (filter.Reason == "" || l.Reason == filter.Reason) && (filter.Replayed || l.ReplayedAt == nil) {
+			res = append(res, l)
+		}
+	}
+	return res, nil
+}
+
+func (r *repoMock) GetDeadLetter(ctx context.Context, id int64) (domain.DeadLetter, error) {
+	for _, l := range r.deadLetters {
+		if l.Id == id {
+			return l, nil
+		}
+	}
+	return domain.DeadLetter{}, domain.ErrDeadLetterNotFound
+}
+
+// ReplayDeadLetter возвращает в Scheduled сообщение записи, если оно в Terminally_Failed или Lost.
+func (r *repoMock) ReplayDeadLetter(ctx context.Context, id int64) (string, error) {
+	letter, err := r.GetDeadLetter(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	status := r.statusByID[letter.MessageId]
+	if status != domain.JobStatusTerminallyFailed && status != domain.JobStatusLost {
+		return "", domain.ErrNotReplayable
+	}
+	r.statusByID[letter.MessageId] = domain.JobStatusScheduled
+	return letter.MessageId, nil
+}
+
+func (r *repoMock) ReleaseLease(ctx context.Context, id string) error {
 	return nil
 }
 
+func (r *repoMock) MarkLostMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	return nil, nil
+}
+
+func (r *repoMock) RequeueOverdueMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	return nil, nil
+}
+
+func (r *repoMock) ListOverdueMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	return nil, nil
+}
+
 type queueMock struct {
 	sent []domain.Message
 	fail bool
@@ -77,12 +247,25 @@ func (c *cacheMock) SetStatus(ctx context.Context, id, status string, ttl time.D
 	return nil
 }
 
+type cancelBusMock struct {
+	published []string
+}
+
+func (b *cancelBusMock) PublishCancel(ctx context.Context, id string) error {
+	b.published = append(b.published, id)
+	return nil
+}
+
+func (b *cancelBusMock) SubscribeCancel(ctx context.Context) (<-chan string, error) {
+	return nil, nil
+}
+
 func TestCreateAndSendMessage_Success(t *testing.T) {
 	r := &repoMock{}
 	q := &queueMock{}
 	c := &cacheMock{}
 
-	uc := NewMessageUsecases(r, q, c)
+	uc := NewMessageUsecases(r, q, c, nil, domain.DefaultRetryPolicies())
 
 	msg := domain.Message{
 		Text:        "hello",
@@ -90,7 +273,7 @@ func TestCreateAndSendMessage_Success(t *testing.T) {
 		ScheduledAt: time.Now().Add(time.Minute),
 	}
 
-	id, err := uc.CreateAndSendMessage(context.Background(), msg)
+	id, _, err := uc.CreateAndSendMessage(context.Background(), msg)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -116,9 +299,9 @@ func TestCreateAndSendMessage_InvalidUser(t *testing.T) {
 	q := &queueMock{}
 	c := &cacheMock{}
 
-	uc := NewMessageUsecases(r, q, c)
+	uc := NewMessageUsecases(r, q, c, nil, domain.DefaultRetryPolicies())
 
-	_, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
 		Text:        "hello",
 		UserId:      0,
 		ScheduledAt: time.Now(),
@@ -139,9 +322,9 @@ func TestCreateAndSendMessage_QueueError(t *testing.T) {
 	q := &queueMock{fail: true}
 	c := &cacheMock{}
 
-	uc := NewMessageUsecases(r, q, c)
+	uc := NewMessageUsecases(r, q, c, nil, domain.DefaultRetryPolicies())
 
-	_, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
 		Text:        "hello",
 		UserId:      1,
 		ScheduledAt: time.Now(),
@@ -154,6 +337,58 @@ func TestCreateAndSendMessage_QueueError(t *testing.T) {
 	}
 }
 
+func TestCreateAndSendMessage_WithoutQueue(t *testing.T) {
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	id, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		Text:        "hello",
+		UserId:      1,
+		ScheduledAt: time.Now().Add(24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if r.createdMsg.Id != id || r.createdMsg.Status != domain.JobStatusScheduled {
+		t.Fatalf("expected message stored as Scheduled for the scheduler, got %+v", r.createdMsg)
+	}
+}
+
+func TestCreateAndSendMessage_IdempotentReplay(t *testing.T) {
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	msg := domain.Message{
+		Text:           "hello",
+		UserId:         1,
+		ScheduledAt:    time.Now().Add(time.Hour),
+		IdempotencyKey: "req-1",
+		RequestHash:    "hash-a",
+	}
+	first, replayed, err := uc.CreateAndSendMessage(context.Background(), msg)
+	if err != nil || replayed {
+		t.Fatalf("expected new message, got replayed=%v err=%v", replayed, err)
+	}
+	second, replayed, err := uc.CreateAndSendMessage(context.Background(), msg)
+	if err != nil || !replayed {
+		t.Fatalf("expected replay without error, got replayed=%v err=%v", replayed, err)
+	}
+	if second != first || len(r.created) != 1 {
+		t.Fatalf("expected original id %s and a single row, got %s and %d rows", first, second, len(r.created))
+	}
+
+	msg.RequestHash = "hash-b"
+	if _, _, err := uc.CreateAndSendMessage(context.Background(), msg); !errors.Is(err, domain.ErrIdempotencyConflict) {
+		t.Fatalf("expected ErrIdempotencyConflict for a different body, got %v", err)
+	}
+
+	// ключи уникальны в пределах пользователя
+	msg.UserId = 2
+	if _, _, err := uc.CreateAndSendMessage(context.Background(), msg); err != nil || len(r.created) != 2 {
+		t.Fatalf("expected the same key to be free for another user, got %v", err)
+	}
+}
+
 func TestGetMessageStatus_UsesCache(t *testing.T) {
 	r := &repoMock{
 		statusByID: map[string]string{
@@ -167,7 +402,7 @@ func TestGetMessageStatus_UsesCache(t *testing.T) {
 	}
 	q := &queueMock{}
 
-	uc := NewMessageUsecases(r, q, c)
+	uc := NewMessageUsecases(r, q, c, nil, domain.DefaultRetryPolicies())
 
 	status, err := uc.GetMessageStatus(context.Background(), "1")
 	if err != nil {
@@ -187,7 +422,7 @@ func TestGetMessageStatus_FillsCacheOnMiss(t *testing.T) {
 	c := &cacheMock{} // пустой кэш
 	q := &queueMock{}
 
-	uc := NewMessageUsecases(r, q, c)
+	uc := NewMessageUsecases(r, q, c, nil, domain.DefaultRetryPolicies())
 
 	status, err := uc.GetMessageStatus(context.Background(), "1")
 	if err != nil {
@@ -200,3 +435,283 @@ func TestGetMessageStatus_FillsCacheOnMiss(t *testing.T) {
 		t.Fatalf("expected cache to be filled with DB status, got %s", cached)
 	}
 }
+
+func TestCreateAndSendMessage_DefaultChannel(t *testing.T) {
+	r := &repoMock{}
+	q := &queueMock{}
+
+	uc := NewMessageUsecases(r, q, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	if _, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		Text:        "hello",
+		UserId:      1,
+		ScheduledAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if r.createdMsg.Channel != domain.ChannelTelegram {
+		t.Fatalf("expected default channel %s, got %q", domain.ChannelTelegram, r.createdMsg.Channel)
+	}
+}
+
+func TestCreateAndSendMessage_UnknownChannel(t *testing.T) {
+	r := &repoMock{}
+	q := &queueMock{}
+
+	uc := NewMessageUsecases(r, q, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		Text:        "hello",
+		UserId:      1,
+		ScheduledAt: time.Now(),
+		Channel:     "pigeon",
+	})
+	if err == nil {
+		t.Fatalf("expected error for unknown channel")
+	}
+	if r.createCalled {
+		t.Fatalf("repository must not be called for unknown channel")
+	}
+}
+
+func TestCreateAndSendMessage_WebhookValidation(t *testing.T) {
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, &queueMock{}, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId:      1,
+		ScheduledAt: time.Now(),
+		Channel:     domain.ChannelWebhook,
+		WebhookURL:  "ftp://example.com/hook",
+	})
+	if err == nil {
+		t.Fatalf("expected error for non-http webhook_url")
+	}
+
+	_, _, err = uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId:      1,
+		ScheduledAt: time.Now(),
+		Channel:     domain.ChannelWebhook,
+		WebhookURL:  "https://example.com/hook",
+		WebhookBody: []byte(`{"broken"`),
+	})
+	if err == nil {
+		t.Fatalf("expected error for invalid webhook_body")
+	}
+	if r.createCalled {
+		t.Fatalf("repository must not be called on invalid webhook")
+	}
+}
+
+func TestCancelMessage_SeriesWithOccurrence(t *testing.T) {
+	r := &repoMock{}
+	c := &cacheMock{}
+	b := &cancelBusMock{}
+	uc := NewMessageUsecases(r, nil, c, b, domain.DefaultRetryPolicies())
+
+	id, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId:      1,
+		ScheduledAt: time.Date(2030, 1, 1, 8, 0, 0, 0, time.UTC),
+		Cron:        "0 9 * * *",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	occ := r.created[1].Id
+
+	if err := uc.CancelMessage(context.Background(), id); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if r.statusByID[id] != domain.JobStatusCancelled || r.statusByID[occ] != domain.JobStatusCancelled {
+		t.Fatalf("expected series and pending occurrence to be cancelled, got %v", r.statusByID)
+	}
+	if len(b.published) != 2 || c.values[occ] != domain.JobStatusCancelled {
+		t.Fatalf("expected cancellations to be broadcast and cached, got %v", b.published)
+	}
+}
+
+func TestCancelMessage_AlreadySent(t *testing.T) {
+	r := &repoMock{statusByID: map[string]string{"m1": domain.JobStatusSent}}
+	b := &cancelBusMock{}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, b, domain.DefaultRetryPolicies())
+
+	err := uc.CancelMessage(context.Background(), "m1")
+	if !errors.Is(err, domain.ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+	if len(b.published) != 0 {
+		t.Fatalf("failed cancellation must not be broadcast")
+	}
+}
+
+func TestUpdateMessage_Reschedules(t *testing.T) {
+	at := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	r := &repoMock{messageByID: map[string]domain.Message{
+		"m1": {Id: "m1", Text: "old", Status: domain.JobStatusQueued, ScheduledAt: at, UserId: 1, Channel: domain.ChannelTelegram},
+	}}
+	c := &cacheMock{}
+	uc := NewMessageUsecases(r, nil, c, nil, domain.DefaultRetryPolicies())
+
+	text := "new"
+	later := at.Add(time.Hour)
+	got, err := uc.UpdateMessage(context.Background(), "m1", domain.MessagePatch{Text: &text, ScheduledAt: &later})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.Text != "new" || !got.ScheduledAt.Equal(later) || got.Status != domain.JobStatusScheduled || got.Revision != 1 {
+		t.Fatalf("unexpected updated message %+v", got)
+	}
+	if c.values["m1"] != domain.JobStatusScheduled {
+		t.Fatalf("expected cached status to be refreshed, got %q", c.values["m1"])
+	}
+}
+
+func TestUpdateMessage_RejectsInvalidRecipient(t *testing.T) {
+	r := &repoMock{messageByID: map[string]domain.Message{
+		"m1": {Id: "m1", Status: domain.JobStatusScheduled, UserId: 1, Channel: domain.ChannelEmail, Email: "a@example.com"},
+	}}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	email := "not-an-email"
+	if _, err := uc.UpdateMessage(context.Background(), "m1", domain.MessagePatch{Email: &email}); err == nil {
+		t.Fatalf("expected invalid email to be rejected")
+	}
+	if r.messageByID["m1"].Email != "a@example.com" {
+		t.Fatalf("rejected patch must not be stored")
+	}
+}
+
+func TestEmailIsStoredAsBareAddress(t *testing.T) {
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	id, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{UserId: 1, Channel: domain.ChannelEmail, Email: "Bob <bob@example.com>"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if r.createdMsg.Email != "bob@example.com" {
+		t.Fatalf("expected display name to be dropped on create, got %q", r.createdMsg.Email)
+	}
+
+	r.messageByID = map[string]domain.Message{id: r.createdMsg}
+	email := "Alice <alice@example.com>"
+	if _, err := uc.UpdateMessage(context.Background(), id, domain.MessagePatch{Email: &email}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if r.messageByID[id].Email != "alice@example.com" {
+		t.Fatalf("expected display name to be dropped on update, got %q", r.messageByID[id].Email)
+	}
+}
+
+func TestSnoozeMessage(t *testing.T) {
+	r := &repoMock{messageByID: map[string]domain.Message{
+		"due":  {Id: "due", Status: domain.JobStatusQueued, ScheduledAt: time.Now().Add(-time.Minute), Channel: domain.ChannelTelegram},
+		"sent": {Id: "sent", Status: domain.JobStatusSent, Channel: domain.ChannelTelegram},
+	}}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	before := time.Now()
+	got, err := uc.SnoozeMessage(context.Background(), "due", 15*time.Minute)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// наступивший срок откладывается от текущего момента
+	if got.ScheduledAt.Before(before.Add(15 * time.Minute)) {
+		t.Fatalf("expected snooze from now, got %s", got.ScheduledAt)
+	}
+
+	if _, err := uc.SnoozeMessage(context.Background(), "sent", 15*time.Minute); !errors.Is(err, domain.ErrNotPending) {
+		t.Fatalf("expected ErrNotPending for sent message, got %v", err)
+	}
+}
+
+func TestListAttempts(t *testing.T) {
+	r := &repoMock{
+		messageByID: map[string]domain.Message{"m1": {Id: "m1"}},
+		attempts: []domain.DeliveryAttempt{
+			{MessageId: "m1", Attempt: 1, Outcome: domain.AttemptFailed},
+			{MessageId: "m2", Attempt: 1, Outcome: domain.AttemptSucceeded},
+		},
+	}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	got, err := uc.ListAttempts(context.Background(), "m1")
+	if err != nil || len(got) != 1 || got[0].Outcome != domain.AttemptFailed {
+		t.Fatalf("expected attempts of m1 only, got %+v %v", got, err)
+	}
+	if _, err := uc.ListAttempts(context.Background(), "missing"); !errors.Is(err, domain.ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound, got %v", err)
+	}
+}
+
+func TestCreateAndSendMessage_UnknownRetryPolicy(t *testing.T) {
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId:      1,
+		ScheduledAt: time.Now(),
+		RetryPolicy: "forever",
+	})
+	if err == nil || r.createCalled {
+		t.Fatalf("expected unknown retry policy to be rejected before storing")
+	}
+}
+
+func TestCreateAndSendMessage_Priority(t *testing.T) {
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, nil, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	if _, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{UserId: 1, ScheduledAt: time.Now()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.created) != 1 || r.created[0].Priority != domain.PriorityNormal {
+		t.Fatalf("expected default priority to be stored, got %+v", r.created)
+	}
+
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{UserId: 1, ScheduledAt: time.Now(), Priority: "urgent"})
+	if err == nil || len(r.created) != 1 {
+		t.Fatalf("expected unknown priority to be rejected before storing")
+	}
+}
+
+func TestReplayDeadLetters_ByFilter(t *testing.T) {
+	replayedAt := time.Now()
+	r := &repoMock{
+		statusByID: map[string]string{
+			"failed": domain.JobStatusTerminallyFailed,
+			"sent":   domain.JobStatusSent,
+			"old":    domain.JobStatusTerminallyFailed,
+		},
+		deadLetters: []domain.DeadLetter{
+			{Id: 1, MessageId: "failed", Reason: domain.DeadLetterTerminallyFailed},
+			{Id: 2, MessageId: "sent", Reason: domain.DeadLetterTerminallyFailed},
+			{Id: 3, MessageId: "old", Reason: domain.DeadLetterTerminallyFailed, ReplayedAt: &replayedAt},
+			{Id: 4, Reason: domain.DeadLetterUnparseable},
+		},
+	}
+	cache := &cacheMock{}
+	uc := NewMessageUsecases(r, nil, cache, nil, domain.DefaultRetryPolicies())
+
+	res, err := uc.ReplayDeadLetters(context.Background(), nil, &domain.DeadLetterFilter{Reason: domain.DeadLetterTerminallyFailed, Replayed: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// уже повторённая запись 3 в выборку не попадает, даже если фильтр просит
+	if len(res.Replayed) != 1 || res.Replayed[0] != 1 || len(res.Skipped) != 1 || res.Skipped[0].Id != 2 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if r.statusByID["failed"] != domain.JobStatusScheduled || cache.values["failed"] != domain.JobStatusScheduled {
+		t.Fatalf("expected replayed message to be rescheduled")
+	}
+	if r.statusByID["old"] != domain.JobStatusTerminallyFailed {
+		t.Fatalf("expected already replayed entry to be left alone")
+	}
+}
+
+func TestReplayDeadLetters_RequiresSelection(t *testing.T) {
+	uc := NewMessageUsecases(&repoMock{}, nil, nil, nil, domain.DefaultRetryPolicies())
+	if _, err := uc.ReplayDeadLetters(context.Background(), nil, nil); err == nil {
+		t.Fatalf("expected error without ids and filter")
+	}
+}
@@ -0,0 +1,204 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+	"github.com/dontpanicw/DelayedNotifier/pkg/schedule"
+	"github.com/google/uuid"
+)
+
+var _ port.Recurrence = (*RecurrenceUsecases)(nil)
+
+type RecurrenceUsecases struct {
+	repo  port.Repository
+	queue port.MessageQueue
+}
+
+func NewRecurrenceUsecases(repo port.Repository, queue port.MessageQueue) *RecurrenceUsecases {
+	return &RecurrenceUsecases{
+		repo:  repo,
+		queue: queue,
+	}
+}
+
+// ScheduleNext вызывается воркером после окончательной обработки вхождения
+// (доставлено или терминально упало) и планирует следующее.
+func (r *RecurrenceUsecases) ScheduleNext(ctx context.Context, occurrence domain.Message) error {
+	if occurrence.ParentId == "" {
+		return nil
+	}
+
+	parent, err := r.repo.GetMessage(ctx, occurrence.ParentId)
+	if errors.Is(err, domain.ErrMessageNotFound) {
+		// серию удалили — будущих запусков нет
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if parent.Status != domain.JobStatusRecurring {
+		return nil
+	}
+
+	sched, err := recurrenceSchedule(parent)
+	if err != nil {
+		return err
+	}
+	// пропущенные во время простоя запуски не догоняем
+	after := occurrence.ScheduledAt
+	if now := time.Now(); after.Before(now) {
+		after = now
+	}
+	next := sched.Next(after)
+	n := occurrence.Occurrence + 1
+
+	if seriesExhausted(parent, next, n) {
+		err := r.repo.UpdateMessageStatus(ctx, parent.Id, domain.JobStatusCompleted)
+		if errors.Is(err, domain.ErrInvalidTransition) {
+			// серию уже завершили или отменили параллельно
+			return nil
+		}
+		return err
+	}
+
+	occ := newOccurrence(parent, next, n)
+	if err := r.repo.CreateMessage(ctx, occ); err != nil {
+		if errors.Is(err, domain.ErrMessageExists) {
+			// вхождение уже запланировано при повторной обработке предыдущего
+			return nil
+		}
+		return err
+	}
+	if r.queue == nil {
+		return nil
+	}
+	return r.queue.SendMessage(ctx, occ)
+}
+
+// maxPreviewOccurrences ограничивает ответ предпросмотра для частых правил.
+const maxPreviewOccurrences = 1000
+
+// recurrenceSchedule строит расписание по полям повторения сообщения.
+// Правило вычисляется по настенным часам зоны получателя.
+func recurrenceSchedule(message domain.Message) (schedule.Schedule, error) {
+	loc := message.Location()
+	switch {
+	case message.Cron != "" && message.RRule != "":
+		return nil, errors.New("cron and rrule are mutually exclusive")
+	case message.Cron != "":
+		c, err := schedule.ParseCron(message.Cron)
+		if err != nil {
+			return nil, err
+		}
+		return schedule.InLocation(c, loc), nil
+	case message.RRule != "":
+		return schedule.ParseRRule(message.RRule, message.ScheduledAt.In(loc))
+	}
+	return nil, errors.New("message has no recurrence rule")
+}
+
+// previewOccurrences перечисляет будущие срабатывания серии в [from, to],
+// не создавая записей. parent.ScheduledAt — первое вхождение серии.
+func previewOccurrences(parent domain.Message, from, to time.Time) ([]time.Time, error) {
+	res := []time.Time{}
+	if parent.Status != domain.JobStatusRecurring {
+		return res, nil
+	}
+	sched, err := recurrenceSchedule(parent)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, n := firstOccurrence(sched, parent.ScheduledAt), 1
+	if parent.MaxOccurrences == 0 && cur.Before(from) {
+		// номер вхождения нужен только для max_occurrences — без него начинаем сразу с from
+		cur = firstOccurrence(sched, from)
+	}
+	for !seriesExhausted(parent, cur, n) && !cur.After(to) && len(res) < maxPreviewOccurrences {
+		if !cur.Before(from) {
+			res = append(res, cur)
+		}
+		cur = sched.Next(cur)
+		n++
+	}
+	return res, nil
+}
+
+// firstOccurrence возвращает первое срабатывание не раньше start.
+func firstOccurrence(sched schedule.Schedule, start time.Time) time.Time {
+	return sched.Next(start.Add(-time.Nanosecond))
+}
+
+func seriesExhausted(parent domain.Message, next time.Time, n int) bool {
+	if next.IsZero() {
+		return true
+	}
+	if parent.MaxOccurrences > 0 && n > parent.MaxOccurrences {
+		return true
+	}
+	return parent.RepeatUntil != nil && next.After(*parent.RepeatUntil)
+}
+
+// newOccurrence создаёт n-е вхождение серии. Id детерминирован (parent id + номер),
+// поэтому повторное планирование того же вхождения упирается в первичный ключ.
+func newOccurrence(parent domain.Message, at time.Time, n int) domain.Message {
+	occ := parent
+	occ.Id = uuid.NewSHA1(uuid.MustParse(parent.Id), []byte(strconv.Itoa(n))).String()
+	occ.Status = domain.JobStatusScheduled
+	occ.ScheduledAt = at
+	occ.ParentId = parent.Id
+	occ.Occurrence = n
+	occ.Cron = ""
+	occ.RRule = ""
+	occ.RepeatUntil = nil
+	occ.MaxOccurrences = 0
+	occ.IdempotencyKey = ""
+	occ.RequestHash = ""
+	return occ
+}
+
+// createRecurring сохраняет родителя серии и ставит в очередь первое вхождение.
+func (m *MessageUsecases) createRecurring(ctx context.Context, message domain.Message) (string, bool, error) {
+	if message.MaxOccurrences < 0 {
+		return "", false, errors.New("max_occurrences must not be negative")
+	}
+
+	start := message.ScheduledAt
+	if start.IsZero() {
+		start = time.Now().Truncate(time.Second)
+	}
+	if message.RRule != "" && !schedule.HasDTStart(message.RRule) {
+		// правило хранится самодостаточным, чтобы серия не зависела от scheduled_at родителя
+		message.RRule = schedule.FormatDTStart(start.In(message.Location())) + "\n" + message.RRule
+	}
+	sched, err := recurrenceSchedule(message)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid recurrence: %w", err)
+	}
+	first := firstOccurrence(sched, start)
+	if seriesExhausted(message, first, 1) {
+		return "", false, errors.New("recurrence has no occurrences in the requested range")
+	}
+
+	message.Id = uuid.NewString()
+	message.Status = domain.JobStatusRecurring
+	message.ScheduledAt = first
+	occ := newOccurrence(message, first, 1)
+	// родитель без первого вхождения навсегда остался бы Recurring, а повтор запроса
+	// с тем же ключом вернул бы его как успех
+	if err := m.repo.CreateSeries(ctx, message, occ); err != nil {
+		return m.resolveDuplicate(ctx, message, err)
+	}
+	if err := m.enqueue(ctx, occ); err != nil {
+		return "", false, err
+	}
+	log.Printf("recurring message %s created, first occurrence %s at %s", message.Id, occ.Id, first)
+	return message.Id, false, nil
+}
@@ -0,0 +1,276 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+func TestCreateAndSendMessage_Recurring(t *testing.T) {
+	r := &repoMock{}
+	q := &queueMock{}
+	uc := NewMessageUsecases(r, q, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	start := time.Date(2030, 1, 1, 8, 0, 0, 0, time.UTC)
+	id, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		Text:        "standup",
+		UserId:      1,
+		ScheduledAt: start,
+		Cron:        "0 9 * * 1-5",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(r.created) != 2 {
+		t.Fatalf("expected parent and first occurrence to be stored, got %d rows", len(r.created))
+	}
+
+	parent, occ := r.created[0], r.created[1]
+	if parent.Id != id || parent.Status != domain.JobStatusRecurring {
+		t.Fatalf("expected recurring parent with returned id, got %+v", parent)
+	}
+	want := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)
+	if occ.ParentId != id || occ.Occurrence != 1 || !occ.ScheduledAt.Equal(want) || occ.Cron != "" {
+		t.Fatalf("unexpected first occurrence %+v", occ)
+	}
+	if len(q.sent) != 1 || q.sent[0].Id != occ.Id {
+		t.Fatalf("expected only the occurrence to be queued")
+	}
+}
+
+func TestCreateAndSendMessage_RecurringSeriesFailure(t *testing.T) {
+	r := &repoMock{seriesErr: errors.New("tx aborted")}
+	q := &queueMock{}
+	uc := NewMessageUsecases(r, q, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId:         1,
+		IdempotencyKey: "standup",
+		ScheduledAt:    time.Date(2030, 1, 1, 8, 0, 0, 0, time.UTC),
+		Cron:           "0 9 * * *",
+	})
+	if err == nil {
+		t.Fatalf("expected series insert error to be returned")
+	}
+	if len(r.created) != 0 || len(q.sent) != 0 {
+		t.Fatalf("expected no parent without its first occurrence, got %d rows", len(r.created))
+	}
+}
+
+func TestCreateAndSendMessage_InvalidCron(t *testing.T) {
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, &queueMock{}, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId: 1,
+		Cron:   "every day",
+	})
+	if err == nil {
+		t.Fatalf("expected error for invalid cron")
+	}
+	if r.createCalled {
+		t.Fatalf("repository must not be called for invalid cron")
+	}
+}
+
+func recurringParent(maxOccurrences int) domain.Message {
+	return domain.Message{
+		Id:             "9f0f1b1e-2a48-4c55-8f3c-6d1f9e0b7a11",
+		Status:         domain.JobStatusRecurring,
+		UserId:         1,
+		Cron:           "0 9 * * *",
+		MaxOccurrences: maxOccurrences,
+	}
+}
+
+func TestScheduleNext_CreatesNextOccurrence(t *testing.T) {
+	parent := recurringParent(0)
+	r := &repoMock{messageByID: map[string]domain.Message{parent.Id: parent}}
+	q := &queueMock{}
+	rec := NewRecurrenceUsecases(r, q)
+
+	prev := newOccurrence(parent, time.Now().Add(-time.Minute), 1)
+	if err := rec.ScheduleNext(context.Background(), prev); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(q.sent) != 1 {
+		t.Fatalf("expected next occurrence to be queued, got %d", len(q.sent))
+	}
+	next := q.sent[0]
+	if next.Occurrence != 2 || next.ParentId != parent.Id || !next.ScheduledAt.After(time.Now()) {
+		t.Fatalf("unexpected next occurrence %+v", next)
+	}
+
+	// повторная обработка того же вхождения не создаёт дубль
+	if err := rec.ScheduleNext(context.Background(), prev); err != nil {
+		t.Fatalf("expected no error on duplicate, got %v", err)
+	}
+	if len(q.sent) != 1 {
+		t.Fatalf("expected duplicate occurrence not to be queued")
+	}
+}
+
+func TestScheduleNext_StopsAtMaxOccurrences(t *testing.T) {
+	parent := recurringParent(1)
+	r := &repoMock{messageByID: map[string]domain.Message{parent.Id: parent}}
+	q := &queueMock{}
+
+	prev := newOccurrence(parent, time.Now(), 1)
+	if err := NewRecurrenceUsecases(r, q).ScheduleNext(context.Background(), prev); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(q.sent) != 0 {
+		t.Fatalf("expected no more occurrences")
+	}
+	if r.statusByID[parent.Id] != domain.JobStatusCompleted {
+		t.Fatalf("expected parent to be completed, got %q", r.statusByID[parent.Id])
+	}
+}
+
+func TestScheduleNext_AlreadyCompleted(t *testing.T) {
+	parent := recurringParent(1)
+	r := &repoMock{
+		messageByID: map[string]domain.Message{parent.Id: parent},
+		statusByID:  map[string]string{parent.Id: domain.JobStatusCompleted},
+	}
+
+	// серию завершил другой воркер между чтением родителя и обновлением статуса
+	prev := newOccurrence(parent, time.Now(), 1)
+	if err := NewRecurrenceUsecases(r, &queueMock{}).ScheduleNext(context.Background(), prev); err != nil {
+		t.Fatalf("expected lost completion race to be ignored, got %v", err)
+	}
+}
+
+func TestScheduleNext_CancelledParent(t *testing.T) {
+	parent := recurringParent(0)
+	r := &repoMock{} // родитель удалён
+	q := &queueMock{}
+
+	prev := newOccurrence(parent, time.Now(), 1)
+	if err := NewRecurrenceUsecases(r, q).ScheduleNext(context.Background(), prev); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(q.sent) != 0 {
+		t.Fatalf("cancelled series must not schedule new occurrences")
+	}
+}
+
+func TestCreateAndSendMessage_RRuleWithoutDTStart(t *testing.T) {
+	r := &repoMock{}
+	q := &queueMock{}
+	uc := NewMessageUsecases(r, q, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	start := time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC) // вторник
+	if _, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId:      1,
+		ScheduledAt: start,
+		RRule:       "FREQ=WEEKLY;BYDAY=TH",
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	parent := r.created[0]
+	if parent.RRule != "DTSTART:20300101T090000Z\nFREQ=WEEKLY;BYDAY=TH" {
+		t.Fatalf("expected DTSTART to be stored with the rule, got %q", parent.RRule)
+	}
+	if want := time.Date(2030, 1, 3, 9, 0, 0, 0, time.UTC); !q.sent[0].ScheduledAt.Equal(want) {
+		t.Fatalf("expected first occurrence at %s, got %s", want, q.sent[0].ScheduledAt)
+	}
+}
+
+func TestCreateAndSendMessage_CronAndRRule(t *testing.T) {
+	uc := NewMessageUsecases(&repoMock{}, &queueMock{}, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId: 1,
+		Cron:   "0 9 * * *",
+		RRule:  "FREQ=DAILY",
+	})
+	if err == nil {
+		t.Fatalf("expected error when both cron and rrule are set")
+	}
+}
+
+func TestListOccurrences_RespectsMaxOccurrences(t *testing.T) {
+	parent := domain.Message{
+		Id:             "9f0f1b1e-2a48-4c55-8f3c-6d1f9e0b7a11",
+		Status:         domain.JobStatusRecurring,
+		ScheduledAt:    time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC),
+		RRule:          "DTSTART:20300101T090000Z\nRRULE:FREQ=DAILY",
+		MaxOccurrences: 3,
+	}
+	r := &repoMock{messageByID: map[string]domain.Message{parent.Id: parent}}
+	uc := NewMessageUsecases(r, &queueMock{}, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	got, err := uc.ListOccurrences(context.Background(), parent.Id,
+		time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// третье вхождение — последнее; первое вне диапазона
+	if len(got) != 2 || !got[1].Equal(time.Date(2030, 1, 3, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected occurrences %v", got)
+	}
+}
+
+func TestCreateAndSendMessage_CronInRecipientTimezone(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("tzdata is unavailable: %v", err)
+	}
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, &queueMock{}, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	_, _, err = uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId:      1,
+		ScheduledAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Cron:        "0 9 * * *",
+		Timezone:    "Europe/Moscow",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := time.Date(2030, 1, 1, 9, 0, 0, 0, loc)
+	if occ := r.created[1]; !occ.ScheduledAt.Equal(want) {
+		t.Fatalf("expected 09:00 Moscow time, got %s", occ.ScheduledAt)
+	}
+}
+
+func TestCreateAndSendMessage_UnknownTimezone(t *testing.T) {
+	r := &repoMock{}
+	uc := NewMessageUsecases(r, &queueMock{}, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	_, _, err := uc.CreateAndSendMessage(context.Background(), domain.Message{
+		UserId:      1,
+		ScheduledAt: time.Now(),
+		Timezone:    "Mars/Olympus",
+	})
+	if err == nil || r.createCalled {
+		t.Fatalf("expected unknown timezone to be rejected before storing")
+	}
+}
+
+func TestCancelMessage_OccurrenceContinuesSeries(t *testing.T) {
+	parent := recurringParent(0)
+	occ := newOccurrence(parent, time.Now().Add(time.Hour), 1)
+	r := &repoMock{messageByID: map[string]domain.Message{parent.Id: parent, occ.Id: occ}}
+	q := &queueMock{}
+	uc := NewMessageUsecases(r, q, &cacheMock{}, nil, domain.DefaultRetryPolicies())
+
+	// отменяется одно вхождение, а не серия
+	if err := uc.CancelMessage(context.Background(), occ.Id); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if r.statusByID[occ.Id] != domain.JobStatusCancelled {
+		t.Fatalf("expected occurrence to be cancelled, got %q", r.statusByID[occ.Id])
+	}
+	if len(q.sent) != 1 || q.sent[0].Occurrence != 2 || q.sent[0].ParentId != parent.Id {
+		t.Fatalf("expected series to continue with the next occurrence, got %+v", q.sent)
+	}
+	if _, ok := r.statusByID[parent.Id]; ok {
+		t.Fatalf("cancelling an occurrence must not touch the series, got %q", r.statusByID[parent.Id])
+	}
+}
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS channel VARCHAR(32) NOT NULL DEFAULT 'telegram';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS channel;
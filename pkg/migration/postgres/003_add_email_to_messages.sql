@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS email VARCHAR(320) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS email;
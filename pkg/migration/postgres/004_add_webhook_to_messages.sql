@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS webhook_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS webhook_headers JSONB;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS webhook_body JSONB;
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS webhook_body;
+ALTER TABLE messages DROP COLUMN IF EXISTS webhook_headers;
+ALTER TABLE messages DROP COLUMN IF EXISTS webhook_url;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS cron VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS repeat_until TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS max_occurrences INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES messages (id) ON DELETE CASCADE;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS occurrence INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_messages_parent_id ON messages (parent_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_parent_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS occurrence;
+ALTER TABLE messages DROP COLUMN IF EXISTS parent_id;
+ALTER TABLE messages DROP COLUMN IF EXISTS max_occurrences;
+ALTER TABLE messages DROP COLUMN IF EXISTS repeat_until;
+ALTER TABLE messages DROP COLUMN IF EXISTS cron;
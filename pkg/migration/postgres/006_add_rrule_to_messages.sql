@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS rrule TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS rrule;
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_messages_due ON messages (scheduled_at) WHERE status = 'Scheduled';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_due;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS request_hash TEXT NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_idempotency ON messages (user_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_idempotency;
+ALTER TABLE messages DROP COLUMN IF EXISTS request_hash;
+ALTER TABLE messages DROP COLUMN IF EXISTS idempotency_key;
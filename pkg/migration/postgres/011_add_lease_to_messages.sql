@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS lease_until TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_messages_lease ON messages (lease_until) WHERE status = 'Sending';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_lease;
+ALTER TABLE messages DROP COLUMN IF EXISTS lease_until;
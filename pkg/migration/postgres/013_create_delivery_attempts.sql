@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS delivery_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    message_id UUID NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    channel VARCHAR(50) NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    outcome VARCHAR(50) NOT NULL,
+    error_class VARCHAR(50) NOT NULL DEFAULT '',
+    response_code INTEGER NOT NULL DEFAULT 0,
+    response_body TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    UNIQUE (message_id, attempt)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS delivery_attempts;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS retry_policy VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_messages_retry_due ON messages (next_attempt_at) WHERE status = 'Failed';
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_retry_due;
+ALTER TABLE messages DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS attempts;
+ALTER TABLE messages DROP COLUMN IF EXISTS retry_policy;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    message_id UUID REFERENCES messages (id) ON DELETE SET NULL,
+    reason VARCHAR(50) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    payload TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    replayed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_created_at ON dead_letters (created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_dead_letters_message_id ON dead_letters (message_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS dead_letters;
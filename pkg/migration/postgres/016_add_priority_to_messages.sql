@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS priority VARCHAR(16) NOT NULL DEFAULT 'normal';
+
+-- +goose Down
+ALTER TABLE messages DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS idx_outbox_message ON outbox (message_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_outbox_message;
@@ -0,0 +1,62 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron_Next(t *testing.T) {
+	base := time.Date(2026, time.March, 6, 10, 30, 0, 0, time.UTC) // пятница
+
+	cases := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"*/15 * * * *", base, time.Date(2026, 3, 6, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", base, time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, 3, 9, 8, 0, 0, 0, time.UTC), time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", base, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 feb *", base, time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 8 * * 7", base, time.Date(2026, 3, 8, 8, 0, 0, 0, time.UTC)},
+		// заданы и день месяца, и день недели — срабатывает по любому из них
+		{"0 0 13 * 5", base, time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range cases {
+		c, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("%q: unexpected parse error: %v", tc.expr, err)
+		}
+		if got := c.Next(tc.after); !got.Equal(tc.want) {
+			t.Fatalf("%q: expected %s, got %s", tc.expr, tc.want, got)
+		}
+	}
+}
+
+func TestCron_NextIsStrictlyAfter(t *testing.T) {
+	c, _ := ParseCron("0 9 * * *")
+	at := time.Date(2026, 3, 6, 9, 0, 0, 0, time.UTC)
+
+	if got := c.Next(at); !got.Equal(at.AddDate(0, 0, 1)) {
+		t.Fatalf("expected next day, got %s", got)
+	}
+}
+
+func TestCron_NeverFires(t *testing.T) {
+	c, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	if got := c.Next(time.Now()); !got.IsZero() {
+		t.Fatalf("expected zero time for impossible date, got %s", got)
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
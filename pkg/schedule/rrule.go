@@ -0,0 +1,587 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency — значение FREQ правила RRULE.
+type Frequency int
+
+const (
+	Minutely Frequency = iota
+	Hourly
+	Daily
+	Weekly
+	Monthly
+	Yearly
+)
+
+var frequencies = map[string]Frequency{
+	"MINUTELY": Minutely,
+	"HOURLY":   Hourly,
+	"DAILY":    Daily,
+	"WEEKLY":   Weekly,
+	"MONTHLY":  Monthly,
+	"YEARLY":   Yearly,
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+const (
+	icalDateTimeUTC = "20060102T150405Z"
+	icalDateTime    = "20060102T150405"
+	icalDate        = "20060102"
+)
+
+// weekdayNum — элемент BYDAY: день недели с необязательным порядковым номером
+// (например, -1FR — последняя пятница).
+type weekdayNum struct {
+	n       int
+	weekday time.Weekday
+}
+
+// RRule — правило повторения RFC 5545 вместе с DTSTART и EXDATE.
+// Вхождения вычисляются лениво: Next перебирает периоды правила,
+// не материализуя всю (возможно бесконечную) серию.
+type RRule struct {
+	freq       Frequency
+	interval   int
+	count      int
+	until      time.Time
+	byMonth    []int
+	byMonthDay []int
+	byDay      []weekdayNum
+	byHour     []int
+	byMinute   []int
+	bySetPos   []int
+	wkst       time.Weekday
+
+	dtstart time.Time
+	// исключённые моменты (Unix-секунды) и дни (EXDATE;VALUE=DATE)
+	exTimes map[int64]struct{}
+	exDates map[string]struct{}
+}
+
+// ParseRRule разбирает описание повторения в формате iCalendar:
+//
+//	DTSTART;TZID=Europe/Moscow:20260102T090000
+//	RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;UNTIL=20261231T235959Z
+//	EXDATE:20260115T060000Z
+//
+// Строка "RRULE:" может быть опущена. Если DTSTART не указан, используется start;
+// время без зоны трактуется в зоне start.
+func ParseRRule(text string, start time.Time) (*RRule, error) {
+	r := &RRule{
+		interval: 1,
+		wkst:     time.Monday,
+		dtstart:  start,
+		exTimes:  make(map[int64]struct{}),
+		exDates:  make(map[string]struct{}),
+	}
+	loc := start.Location()
+
+	var rule string
+	var exdates []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToUpper(line), "FREQ=") {
+			line = "RRULE:" + line
+		}
+		head, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("rrule: invalid line %q", line)
+		}
+		name, params, _ := strings.Cut(head, ";")
+
+		switch strings.ToUpper(name) {
+		case "RRULE":
+			if rule != "" {
+				return nil, fmt.Errorf("rrule: only one RRULE is supported")
+			}
+			rule = value
+		case "DTSTART":
+			t, _, err := parseICalTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("rrule: invalid DTSTART: %w", err)
+			}
+			r.dtstart = t
+			loc = t.Location()
+		case "EXDATE":
+			// разбираем после DTSTART, чтобы знать зону по умолчанию
+			exdates = append(exdates, params+"\x00"+value)
+		default:
+			return nil, fmt.Errorf("rrule: unsupported property %q", name)
+		}
+	}
+	if rule == "" {
+		return nil, fmt.Errorf("rrule: RRULE is required")
+	}
+	if err := r.parseRule(rule, loc); err != nil {
+		return nil, err
+	}
+
+	for _, ex := range exdates {
+		params, values, _ := strings.Cut(ex, "\x00")
+		for _, v := range strings.Split(values, ",") {
+			t, dateOnly, err := parseICalTime(v, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("rrule: invalid EXDATE: %w", err)
+			}
+			if dateOnly {
+				r.exDates[t.Format(icalDate)] = struct{}{}
+			} else {
+				r.exTimes[t.Unix()] = struct{}{}
+			}
+		}
+	}
+	return r, nil
+}
+
+// HasDTStart сообщает, содержит ли текст правила собственный DTSTART.
+func HasDTStart(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(line)), "DTSTART") {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatDTStart возвращает строку DTSTART для момента t: в UTC или с TZID его зоны.
+func FormatDTStart(t time.Time) string {
+	if t.Location() == time.UTC {
+		return "DTSTART:" + t.Format(icalDateTimeUTC)
+	}
+	return "DTSTART;TZID=" + t.Location().String() + ":" + t.Format(icalDateTime)
+}
+
+func (r *RRule) parseRule(rule string, loc *time.Location) error {
+	var hasFreq bool
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("rrule: invalid part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			f, ok := frequencies[strings.ToUpper(value)]
+			if !ok {
+				return fmt.Errorf("rrule: unsupported FREQ %q", value)
+			}
+			r.freq, hasFreq = f, true
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(value)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(value)
+			if err == nil && r.count < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "UNTIL":
+			r.until, err = parseUntil(value, loc)
+		case "BYMONTH":
+			r.byMonth, err = parseInts(value, 1, 12, false)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseInts(value, 1, 31, true)
+		case "BYHOUR":
+			r.byHour, err = parseInts(value, 0, 23, false)
+		case "BYMINUTE":
+			r.byMinute, err = parseInts(value, 0, 59, false)
+		case "BYSETPOS":
+			r.bySetPos, err = parseInts(value, 1, 366, true)
+		case "BYDAY":
+			r.byDay, err = parseByDay(value)
+		case "WKST":
+			wd, ok := weekdays[strings.ToUpper(value)]
+			if !ok {
+				err = fmt.Errorf("unknown weekday")
+			}
+			r.wkst = wd
+		default:
+			return fmt.Errorf("rrule: unsupported part %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("rrule: invalid %s=%s: %w", key, value, err)
+		}
+	}
+
+	if !hasFreq {
+		return fmt.Errorf("rrule: FREQ is required")
+	}
+	if r.count > 0 && !r.until.IsZero() {
+		return fmt.Errorf("rrule: COUNT and UNTIL must not be used together")
+	}
+	for _, wd := range r.byDay {
+		if wd.n != 0 && r.freq != Monthly && r.freq != Yearly {
+			return fmt.Errorf("rrule: BYDAY with ordinal is allowed only for MONTHLY and YEARLY")
+		}
+	}
+	return nil
+}
+
+func parseICalTime(value, params string, loc *time.Location) (time.Time, bool, error) {
+	dateOnly := false
+	for _, p := range strings.Split(params, ";") {
+		k, v, _ := strings.Cut(p, "=")
+		switch strings.ToUpper(k) {
+		case "TZID":
+			l, err := time.LoadLocation(v)
+			if err != nil {
+				return time.Time{}, false, err
+			}
+			loc = l
+		case "VALUE":
+			dateOnly = strings.EqualFold(v, "DATE")
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		t, err := time.Parse(icalDateTimeUTC, value)
+		return t, false, err
+	case len(value) == len(icalDate):
+		t, err := time.ParseInLocation(icalDate, value, loc)
+		return t, true, err
+	default:
+		if dateOnly {
+			return time.Time{}, false, fmt.Errorf("expected date, got %q", value)
+		}
+		t, err := time.ParseInLocation(icalDateTime, value, loc)
+		return t, false, err
+	}
+}
+
+// parseUntil разбирает UNTIL; дата без времени включает весь день.
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	t, dateOnly, err := parseICalTime(value, "", loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if dateOnly {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return t, nil
+}
+
+func parseInts(value string, lo, hi int, allowNegative bool) ([]int, error) {
+	var res []int
+	for _, s := range strings.Split(value, ",") {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		abs := v
+		if allowNegative && v < 0 {
+			abs = -v
+		}
+		if abs < lo || abs > hi {
+			return nil, fmt.Errorf("value %d out of range", v)
+		}
+		res = append(res, v)
+	}
+	sort.Ints(res)
+	return res, nil
+}
+
+func parseByDay(value string) ([]weekdayNum, error) {
+	var res []weekdayNum
+	for _, s := range strings.Split(strings.ToUpper(value), ",") {
+		if len(s) < 2 {
+			return nil, fmt.Errorf("invalid weekday %q", s)
+		}
+		wd, ok := weekdays[s[len(s)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", s)
+		}
+		n := 0
+		if prefix := s[:len(s)-2]; prefix != "" {
+			var err error
+			n, err = strconv.Atoi(prefix)
+			if err != nil || n == 0 || n < -53 || n > 53 {
+				return nil, fmt.Errorf("invalid weekday ordinal %q", s)
+			}
+		}
+		res = append(res, weekdayNum{n: n, weekday: wd})
+	}
+	return res, nil
+}
+
+// DTStart возвращает начало серии.
+func (r *RRule) DTStart() time.Time {
+	return r.dtstart
+}
+
+// Next возвращает первое вхождение строго после after.
+// COUNT учитывает и вхождения, исключённые через EXDATE (RFC 5545).
+func (r *RRule) Next(after time.Time) time.Time {
+	k := 0
+	if r.count == 0 {
+		// без COUNT не нужно считать вхождения с начала — перескакиваем к after
+		k = r.skipPeriods(after)
+	}
+
+	limit := after
+	if limit.Before(r.dtstart) {
+		limit = r.dtstart
+	}
+	limit = limit.Add(horizon)
+
+	emitted := 0
+	for ; ; k++ {
+		start := r.periodStart(k)
+		if start.After(limit) || (!r.until.IsZero() && start.After(r.until)) {
+			return time.Time{}
+		}
+		for _, t := range r.periodCandidates(start) {
+			if t.Before(r.dtstart) {
+				continue
+			}
+			if !r.until.IsZero() && t.After(r.until) {
+				return time.Time{}
+			}
+			emitted++
+			if r.count > 0 && emitted > r.count {
+				return time.Time{}
+			}
+			if r.excluded(t) {
+				continue
+			}
+			if t.After(after) {
+				return t
+			}
+		}
+	}
+}
+
+func (r *RRule) excluded(t time.Time) bool {
+	if _, ok := r.exTimes[t.Unix()]; ok {
+		return true
+	}
+	_, ok := r.exDates[t.In(r.dtstart.Location()).Format(icalDate)]
+	return ok
+}
+
+// skipPeriods оценивает номер периода чуть раньше after с запасом,
+// чтобы не начинать перебор бесконечного правила с DTSTART.
+func (r *RRule) skipPeriods(after time.Time) int {
+	if !after.After(r.dtstart) {
+		return 0
+	}
+	d := after.Sub(r.dtstart)
+	var periods int
+	switch r.freq {
+	case Yearly:
+		periods = after.Year() - r.dtstart.Year()
+	case Monthly:
+		periods = (after.Year()-r.dtstart.Year())*12 + int(after.Month()) - int(r.dtstart.Month())
+	case Weekly:
+		periods = int(d / (7 * 24 * time.Hour))
+	case Daily:
+		periods = int(d / (24 * time.Hour))
+	case Hourly:
+		periods = int(d / time.Hour)
+	case Minutely:
+		periods = int(d / time.Minute)
+	}
+	return max(periods/r.interval-2, 0)
+}
+
+// periodStart возвращает начало k-го периода правила.
+func (r *RRule) periodStart(k int) time.Time {
+	dt := r.dtstart
+	loc := dt.Location()
+	step := k * r.interval
+	switch r.freq {
+	case Yearly:
+		return time.Date(dt.Year()+step, time.January, 1, 0, 0, 0, 0, loc)
+	case Monthly:
+		return time.Date(dt.Year(), dt.Month()+time.Month(step), 1, 0, 0, 0, 0, loc)
+	case Weekly:
+		offset := (int(dt.Weekday()) - int(r.wkst) + 7) % 7
+		return time.Date(dt.Year(), dt.Month(), dt.Day()-offset+7*step, 0, 0, 0, 0, loc)
+	case Daily:
+		return time.Date(dt.Year(), dt.Month(), dt.Day()+step, 0, 0, 0, 0, loc)
+	case Hourly:
+		base := time.Date(dt.Year(), dt.Month(), dt.Day(), dt.Hour(), 0, 0, 0, loc)
+		return base.Add(time.Duration(step) * time.Hour)
+	default:
+		base := time.Date(dt.Year(), dt.Month(), dt.Day(), dt.Hour(), dt.Minute(), 0, 0, loc)
+		return base.Add(time.Duration(step) * time.Minute)
+	}
+}
+
+// periodCandidates возвращает отсортированные вхождения периода с учётом BYSETPOS.
+func (r *RRule) periodCandidates(start time.Time) []time.Time {
+	loc := start.Location()
+	sec := r.dtstart.Second()
+	var res []time.Time
+
+	switch r.freq {
+	case Hourly, Minutely:
+		if !r.dayMatches(start.Year(), start.Month(), start.Day()) || !limitMatches(r.byHour, start.Hour()) {
+			return nil
+		}
+		if r.freq == Minutely {
+			if limitMatches(r.byMinute, start.Minute()) {
+				res = append(res, start.Add(time.Duration(sec)*time.Second))
+			}
+			break
+		}
+		for _, m := range r.minutes() {
+			res = append(res, start.Add(time.Duration(m)*time.Minute+time.Duration(sec)*time.Second))
+		}
+	default:
+		var days int
+		switch r.freq {
+		case Yearly:
+			days = time.Date(start.Year(), time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		case Monthly:
+			days = daysIn(start.Month(), start.Year())
+		case Weekly:
+			days = 7
+		default:
+			days = 1
+		}
+		for i := 0; i < days; i++ {
+			y, m, d := time.Date(start.Year(), start.Month(), start.Day()+i, 12, 0, 0, 0, time.UTC).Date()
+			if !r.dayMatches(y, m, d) {
+				continue
+			}
+			for _, h := range r.hours() {
+				for _, mi := range r.minutes() {
+					res = append(res, localTime(y, m, d, h, mi, sec, loc))
+				}
+			}
+		}
+	}
+
+	if len(r.bySetPos) == 0 || len(res) == 0 {
+		return res
+	}
+	var picked []time.Time
+	for _, pos := range r.bySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(res) + pos
+		}
+		if i >= 0 && i < len(res) {
+			picked = append(picked, res[i])
+		}
+	}
+	sort.Slice(picked, func(i, j int) bool { return picked[i].Before(picked[j]) })
+	return picked
+}
+
+func (r *RRule) hours() []int {
+	if len(r.byHour) > 0 {
+		return r.byHour
+	}
+	return []int{r.dtstart.Hour()}
+}
+
+func (r *RRule) minutes() []int {
+	if len(r.byMinute) > 0 {
+		return r.byMinute
+	}
+	return []int{r.dtstart.Minute()}
+}
+
+// dayMatches применяет BYMONTH/BYMONTHDAY/BYDAY, а при их отсутствии —
+// значения по умолчанию из DTSTART (месяц для YEARLY, число для MONTHLY/YEARLY,
+// день недели для WEEKLY).
+func (r *RRule) dayMatches(y int, m time.Month, d int) bool {
+	dt := r.dtstart
+	if len(r.byMonth) > 0 {
+		if !containsInt(r.byMonth, int(m)) {
+			return false
+		}
+	} else if r.freq == Yearly && len(r.byMonthDay) == 0 && len(r.byDay) == 0 && m != dt.Month() {
+		return false
+	}
+
+	if len(r.byMonthDay) > 0 {
+		dim := daysIn(m, y)
+		ok := false
+		for _, md := range r.byMonthDay {
+			if md == d || (md < 0 && dim+md+1 == d) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	} else if len(r.byDay) == 0 && (r.freq == Yearly || r.freq == Monthly) && d != dt.Day() {
+		return false
+	}
+
+	date := time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+	if len(r.byDay) > 0 {
+		return r.weekdayMatches(date)
+	}
+	if r.freq == Weekly {
+		return date.Weekday() == dt.Weekday()
+	}
+	return true
+}
+
+func (r *RRule) weekdayMatches(date time.Time) bool {
+	monthScope := r.freq == Monthly || (r.freq == Yearly && len(r.byMonth) > 0)
+	for _, wd := range r.byDay {
+		if wd.weekday != date.Weekday() {
+			continue
+		}
+		if wd.n == 0 {
+			return true
+		}
+		var pos, total int
+		if monthScope {
+			pos, total = date.Day(), daysIn(date.Month(), date.Year())
+		} else {
+			pos = date.YearDay()
+			total = time.Date(date.Year(), time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		}
+		if wd.n > 0 && (pos-1)/7+1 == wd.n {
+			return true
+		}
+		if wd.n < 0 && (total-pos)/7+1 == -wd.n {
+			return true
+		}
+	}
+	return false
+}
+
+func limitMatches(values []int, v int) bool {
+	return len(values) == 0 || containsInt(values, v)
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func daysIn(m time.Month, year int) int {
+	return time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// localTime собирает момент из локальных компонент в зоне loc по правилам ResolveLocal.
+func localTime(y int, m time.Month, d, h, mi, s int, loc *time.Location) time.Time {
+	return ResolveLocal(y, m, d, h, mi, s, loc)
+}
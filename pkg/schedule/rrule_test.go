@@ -0,0 +1,126 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// collect возвращает первые n вхождений правила.
+func collect(t *testing.T, r *RRule, n int) []time.Time {
+	t.Helper()
+	var res []time.Time
+	cur := r.DTStart().Add(-time.Second)
+	for len(res) < n {
+		cur = r.Next(cur)
+		if cur.IsZero() {
+			break
+		}
+		res = append(res, cur)
+	}
+	return res
+}
+
+func assertTimes(t *testing.T, got []time.Time, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d occurrences, got %d: %v", len(want), len(got), got)
+	}
+	for i, w := range want {
+		wt, err := time.Parse(time.RFC3339, w)
+		if err != nil {
+			t.Fatalf("bad test value %q", w)
+		}
+		if !got[i].Equal(wt) {
+			t.Fatalf("occurrence %d: expected %s, got %s", i, wt, got[i])
+		}
+	}
+}
+
+func TestRRule_LastFridayOfMonth(t *testing.T) {
+	r, err := ParseRRule("DTSTART:20260101T090000Z\nRRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertTimes(t, collect(t, r, 10),
+		"2026-01-30T09:00:00Z",
+		"2026-02-27T09:00:00Z",
+		"2026-03-27T09:00:00Z",
+	)
+}
+
+func TestRRule_BiweeklyTueThuUntil(t *testing.T) {
+	r, err := ParseRRule("DTSTART:20261201T100000Z\nRRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;UNTIL=20261231T235959Z", time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertTimes(t, collect(t, r, 10),
+		"2026-12-01T10:00:00Z",
+		"2026-12-03T10:00:00Z",
+		"2026-12-15T10:00:00Z",
+		"2026-12-17T10:00:00Z",
+		"2026-12-29T10:00:00Z",
+		"2026-12-31T10:00:00Z",
+	)
+}
+
+func TestRRule_ExdateCountsTowardsCount(t *testing.T) {
+	r, err := ParseRRule("DTSTART:20260105T080000Z\nRRULE:FREQ=DAILY;COUNT=3\nEXDATE:20260106T080000Z", time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertTimes(t, collect(t, r, 10),
+		"2026-01-05T08:00:00Z",
+		"2026-01-07T08:00:00Z",
+	)
+}
+
+func TestRRule_TZIDAndDefaultStart(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	r, err := ParseRRule("FREQ=DAILY;BYHOUR=9,18;BYMINUTE=0", start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertTimes(t, collect(t, r, 2), "2026-03-02T18:00:00Z", "2026-03-03T09:00:00Z")
+
+	r, err = ParseRRule("DTSTART;TZID=Europe/Moscow:20260302T090000\nRRULE:FREQ=DAILY;COUNT=1", time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertTimes(t, collect(t, r, 5), "2026-03-02T06:00:00Z")
+}
+
+func TestRRule_InfiniteRuleSkipsAhead(t *testing.T) {
+	r, err := ParseRRule("DTSTART:20200101T000000Z\nRRULE:FREQ=MINUTELY;INTERVAL=5", time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after := time.Date(2030, 6, 1, 12, 2, 0, 0, time.UTC)
+	if got, want := r.Next(after), time.Date(2030, 6, 1, 12, 5, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestRRule_YearlyBySetPos(t *testing.T) {
+	// последний рабочий день года
+	r, err := ParseRRule("DTSTART:20260101T120000Z\nRRULE:FREQ=MONTHLY;BYMONTH=12;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=2", time.Time{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertTimes(t, collect(t, r, 5), "2026-12-31T12:00:00Z", "2027-12-31T12:00:00Z")
+}
+
+func TestParseRRule_Invalid(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"RRULE:INTERVAL=2",
+		"RRULE:FREQ=SECONDLY",
+		"RRULE:FREQ=DAILY;COUNT=2;UNTIL=20261231T000000Z",
+		"RRULE:FREQ=WEEKLY;BYDAY=1MO",
+		"RRULE:FREQ=DAILY;BYWEEKNO=1",
+		"DTSTART;TZID=Mars/Olympus:20260101T000000\nRRULE:FREQ=DAILY",
+	} {
+		if _, err := ParseRRule(text, time.Now()); err == nil {
+			t.Fatalf("expected error for %q", text)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package schedule
+
+import "time"
+
+// ResolveLocal переводит локальное время (настенные часы) в зоне loc в момент времени
+// по явным правилам для переходов на летнее/зимнее время:
+//
+//   - несуществующее время (перевод вперёд, например 02:30 при скачке 02:00→03:00)
+//     сдвигается вперёд на длину скачка — получается 03:30;
+//   - неоднозначное время (перевод назад, 01:30 встречается дважды)
+//     разрешается в более ранний момент — первое прохождение 01:30.
+//
+// time.Date для таких случаев выбор зоны не гарантирует, поэтому расписания
+// используют эту функцию.
+func ResolveLocal(year int, month time.Month, day, hour, min, sec int, loc *time.Location) time.Time {
+	// настенное время как если бы оно было в UTC; момент = wall - offset
+	wall := time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+
+	// смещения до и после возможного перехода (переходы не бывают чаще раза в сутки)
+	before := offsetAt(wall.Add(-24*time.Hour), loc)
+	after := offsetAt(wall.Add(24*time.Hour), loc)
+
+	var candidates []time.Time
+	for _, off := range []int{before, after} {
+		t := wall.Add(-time.Duration(off) * time.Second)
+		if offsetAt(t, loc) == off {
+			candidates = append(candidates, t.In(loc))
+		}
+	}
+
+	switch {
+	case len(candidates) == 0:
+		// попали в "дыру": трактуем время по смещению до перехода, что даёт сдвиг вперёд
+		return wall.Add(-time.Duration(before) * time.Second).In(loc)
+	case len(candidates) == 2 && candidates[1].Before(candidates[0]):
+		return candidates[1]
+	default:
+		return candidates[0]
+	}
+}
+
+func offsetAt(t time.Time, loc *time.Location) int {
+	_, off := t.In(loc).Zone()
+	return off
+}
+
+// InLocation вычисляет срабатывания s по настенным часам зоны loc.
+func InLocation(s Schedule, loc *time.Location) Schedule {
+	return zoned{s: s, loc: loc}
+}
+
+type zoned struct {
+	s   Schedule
+	loc *time.Location
+}
+
+func (z zoned) Next(after time.Time) time.Time {
+	return z.s.Next(after.In(z.loc))
+}
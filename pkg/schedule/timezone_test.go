@@ -0,0 +1,60 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("tzdata for %s is unavailable: %v", name, err)
+	}
+	return loc
+}
+
+func TestResolveLocal(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+
+	cases := []struct {
+		name string
+		got  time.Time
+		want time.Time
+	}{
+		// 8 марта 2026 часы переводятся 02:00 EST → 03:00 EDT: 02:30 не существует
+		{"gap", ResolveLocal(2026, 3, 8, 2, 30, 0, ny), time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC)},
+		// 1 ноября 2026 01:30 встречается дважды — берём первое (EDT)
+		{"overlap", ResolveLocal(2026, 11, 1, 1, 30, 0, ny), time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)},
+		{"regular", ResolveLocal(2026, 6, 1, 9, 0, 0, ny), time.Date(2026, 6, 1, 13, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		if !tc.got.Equal(tc.want) {
+			t.Fatalf("%s: expected %s, got %s", tc.name, tc.want, tc.got.UTC())
+		}
+		if tc.got.Location() != ny {
+			t.Fatalf("%s: expected result in %s, got %s", tc.name, ny, tc.got.Location())
+		}
+	}
+}
+
+func TestCron_DSTTransitions(t *testing.T) {
+	ny := mustLoad(t, "America/New_York")
+
+	// несуществующие 02:30 сдвигаются на 03:30 EDT
+	c, _ := ParseCron("30 2 * * *")
+	got := c.Next(time.Date(2026, 3, 7, 12, 0, 0, 0, ny))
+	if want := time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("gap: expected %s, got %s", want, got.UTC())
+	}
+
+	// 01:30 при переводе назад срабатывает один раз
+	c, _ = ParseCron("30 1 * * *")
+	first := c.Next(time.Date(2026, 10, 31, 12, 0, 0, 0, ny))
+	if want := time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC); !first.Equal(want) {
+		t.Fatalf("overlap: expected %s, got %s", want, first.UTC())
+	}
+	if next := c.Next(first); !next.Equal(time.Date(2026, 11, 2, 6, 30, 0, 0, time.UTC)) {
+		t.Fatalf("overlap: expected single firing, next got %s", next.UTC())
+	}
+}
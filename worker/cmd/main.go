@@ -2,14 +2,25 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"log"
+	"net/http"
 	"os/signal"
 	"syscall"
 
 	"github.com/dontpanicw/DelayedNotifier/config"
+	"github.com/dontpanicw/DelayedNotifier/internal/admin"
 	redisCache "github.com/dontpanicw/DelayedNotifier/internal/adapter/cache/redis"
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/adapter/rabbitmq"
 	"github.com/dontpanicw/DelayedNotifier/internal/adapter/repository/postgres"
+	"github.com/dontpanicw/DelayedNotifier/internal/usecases"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/notifier"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/notifier/email"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/notifier/telegram"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/notifier/webhook"
 	workerRabbit "github.com/dontpanicw/DelayedNotifier/worker/internal/rabbitmq"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/scheduler"
 )
 
 func main() {
@@ -23,16 +34,106 @@ func main() {
 
 	repo := postgres.NewMessageRepository(cfg)
 	cache := redisCache.NewStatusCache(cfg.RedisAddr)
+	cancels := redisCache.NewCancelBus(cfg.RedisAddr)
 
-	consumer, err := workerRabbit.NewMessageQueueConsumer(cfg.RabbitURL, repo, cache)
+	notifiers := notifier.NewRegistry(
+		telegram.NewNotifier(cfg.TelegramBotToken, cfg.TelegramAPIURL),
+		webhook.NewNotifier(cfg.WebhookSecret, cfg.WebhookTimeout, cfg.WebhookAllowPrivate),
+	)
+	if cfg.SMTPAddr != "" {
+		notifiers.Register(email.NewNotifier(email.Config{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.SMTPFrom,
+			Subject:  cfg.SMTPSubject,
+			StartTLS: cfg.SMTPStartTLS,
+		}))
+	} else {
+		log.Print("SMTP_ADDR is not set, email channel is disabled")
+	}
+
+	// продьюсер публикует наступившие уведомления (режим db) или записи outbox (режимы broker и timer)
+	delayBuckets := cfg.SchedulerMode == config.SchedulerModeBroker
+	producer, err := rabbitmq.NewMessageQueueProducer(cfg.RabbitURL, cfg.QueueTTLGrace, delayBuckets, cfg.RetryStrategy(domain.RabbitMQRetryPolicy))
+	if err != nil {
+		log.Fatalf("failed to create RabbitMQ producer: %v", err)
+	}
+	defer producer.Close()
+
+	// статусы, в которых сообщение уведомления лежит в очереди
+	queuedStatuses := []string{domain.JobStatusQueued, domain.JobStatusRetrying}
+	switch cfg.SchedulerMode {
+	case config.SchedulerModeDB:
+		sched := scheduler.NewScheduler(repo, producer, cfg.SchedulerInterval, cfg.SchedulerBatch)
+		go sched.Run(ctx)
+		log.Printf("scheduler started, polling every %s", cfg.SchedulerInterval)
+	case config.SchedulerModeBroker, config.SchedulerModeTimer:
+		relay := scheduler.NewOutboxRelay(repo, producer, cfg.SchedulerInterval, cfg.SchedulerBatch)
+		go relay.Run(ctx)
+		log.Printf("outbox relay started, polling every %s", cfg.SchedulerInterval)
+		queuedStatuses = []string{domain.JobStatusScheduled, domain.JobStatusRetrying}
+	}
+	// следующие вхождения только сохраняются: публикацию берут на себя планировщик или relay
+	recurrence := usecases.NewRecurrenceUsecases(repo, nil)
+
+	reconciler := scheduler.NewReconciler(repo, cache, recurrence, cfg.ReconcilePolicy, queuedStatuses, cfg.QueueTTLGrace, cfg.LostCheckInterval)
+	go reconciler.Run(ctx)
+	log.Printf("reconciler started, policy %s, checking every %s", cfg.ReconcilePolicy, cfg.LostCheckInterval)
+	leases := scheduler.NewLeaseRecovery(repo, cfg.LostCheckInterval)
+	go leases.Run(ctx)
+
+	concurrency := workerRabbit.Concurrency{
+		Workers:  cfg.WorkerConcurrency,
+		Channels: cfg.ChannelConcurrency,
+		Prefetch: cfg.WorkerPrefetch,
+	}
+	consumer, err := workerRabbit.NewMessageQueueConsumer(cfg.RabbitURL, repo, cache, notifiers, recurrence, delayBuckets, cfg.DeliveryLease, cancels, cfg.RetryPolicies, concurrency)
 	if err != nil {
 		log.Fatalf("failed to create RabbitMQ consumer: %v", err)
 	}
-	defer consumer.Close()
+
+	// загрузка пулов доставки: /debug/vars, ключ delivery_pools
+	expvar.Publish("delivery_pools", expvar.Func(func() any { return consumer.PoolStats() }))
+	expvar.Publish("amqp_connected", expvar.Func(func() any { return consumer.Connected() }))
+	expvar.Publish("reconciler", expvar.Func(func() any { return reconciler.Stats() }))
+	// admin‑эндпоинт сверки (GET — счётчики и последний проход, POST — сверить сейчас) слушает
+	// отдельный адрес и требует токен: метрики открыты шире, чем право запускать сверку
+	if cfg.AdminToken != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/admin/reconciler", admin.RequireToken(cfg.AdminToken, reconciler))
+		go func() {
+			if err := http.ListenAndServe(cfg.AdminAddr, adminMux); err != nil {
+				log.Printf("admin listener stopped: %v", err)
+			}
+		}()
+	} else {
+		log.Print("ADMIN_TOKEN is not set, worker admin endpoints are disabled")
+	}
+	// healthz — 503, пока воркер переподключается к RabbitMQ
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !consumer.Connected() {
+			http.Error(w, "rabbitmq disconnected", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	if cfg.MetricsAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(cfg.MetricsAddr, nil); err != nil {
+				log.Printf("metrics listener stopped: %v", err)
+			}
+		}()
+	}
 
 	log.Println("worker started, waiting for messages...")
 	if err := consumer.Start(ctx); err != nil {
 		log.Fatalf("worker stopped with error: %v", err)
 	}
+
+	// приём остановлен: дожидаемся начатых доставок и закрываем канал и соединение
+	log.Printf("worker stopping, draining in-flight deliveries for up to %s", cfg.ShutdownTimeout)
+	consumer.Shutdown(cfg.ShutdownTimeout)
+	log.Println("worker stopped")
 }
 
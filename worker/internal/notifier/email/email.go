@@ -0,0 +1,215 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+const (
+	defaultSubject = "Delayed Notifier"
+	defaultTimeout = 30 * time.Second
+)
+
+// ErrNoRecipient — у сообщения не указан адрес получателя (как ответ 501 на RCPT).
+var ErrNoRecipient = &Error{Code: 501, Msg: "recipient address is empty"}
+
+// Config — параметры подключения к SMTP-серверу.
+type Config struct {
+	Addr     string // host:port
+	Username string // пустой — без AUTH
+	Password string
+	From     string
+	Subject  string
+	StartTLS bool
+	// TLSConfig используется для STARTTLS; если nil, проверяется сертификат хоста из Addr.
+	TLSConfig *tls.Config
+}
+
+// Error — ответ SMTP-сервера с кодом ошибки.
+// 5xx означает постоянную ошибку (несуществующий ящик, отказ в приёме),
+// 4xx — временную (переполнен ящик, greylisting, ограничение частоты).
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("email: smtp %d %s", e.Code, e.Msg)
+}
+
+func (e *Error) Temporary() bool {
+	return e.Code < 500
+}
+
+// ResponseCode и ResponseBody попадают в историю попыток доставки.
+func (e *Error) ResponseCode() int {
+	return e.Code
+}
+
+func (e *Error) ResponseBody() string {
+	return e.Msg
+}
+
+var _ port.Notifier = (*Notifier)(nil)
+
+// Notifier отправляет сообщения письмом через SMTP.
+type Notifier struct {
+	cfg Config
+}
+
+func NewNotifier(cfg Config) *Notifier {
+	if cfg.Subject == "" {
+		cfg.Subject = defaultSubject
+	}
+	return &Notifier{cfg: cfg}
+}
+
+func (n *Notifier) Channel() string {
+	return domain.ChannelEmail
+}
+
+// Send отправляет письмо на msg.Email. Текст сообщения уходит двумя
+// альтернативными частями: text/plain и text/html.
+func (n *Notifier) Send(ctx context.Context, msg domain.Message) error {
+	if msg.Email == "" {
+		return ErrNoRecipient
+	}
+
+	body, err := n.buildMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(n.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("email: invalid smtp address %q: %w", n.cfg.Addr, err)
+	}
+
+	dialer := &net.Dialer{Timeout: defaultTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("email: dial failed: %w", err)
+	}
+	deadline := time.Now().Add(defaultTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return wrapSMTPError(err)
+	}
+	defer c.Close()
+
+	if n.cfg.StartTLS {
+		tlsCfg := n.cfg.TLSConfig
+		if tlsCfg == nil {
+			tlsCfg = &tls.Config{ServerName: host}
+		}
+		if err := c.StartTLS(tlsCfg); err != nil {
+			return wrapSMTPError(err)
+		}
+	}
+	if n.cfg.Username != "" {
+		auth := smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, host)
+		if err := c.Auth(auth); err != nil {
+			return wrapSMTPError(err)
+		}
+	}
+
+	if err := c.Mail(n.cfg.From); err != nil {
+		return wrapSMTPError(err)
+	}
+	if err := c.Rcpt(msg.Email); err != nil {
+		return wrapSMTPError(err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return wrapSMTPError(err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return wrapSMTPError(err)
+	}
+	// код ответа на DATA приходит при закрытии writer'а — это и есть подтверждение приёма
+	if err := w.Close(); err != nil {
+		return wrapSMTPError(err)
+	}
+	_ = c.Quit()
+	return nil
+}
+
+// buildMessage собирает письмо multipart/alternative из msg.Text.
+func (n *Notifier) buildMessage(msg domain.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	headers := []string{
+		"From: " + n.cfg.From,
+		"To: " + msg.Email,
+		"Subject: " + mime.QEncoding.Encode("utf-8", n.cfg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + msg.Id + "@delayed-notifier>",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + mw.Boundary(),
+	}
+	buf.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	htmlBody := "<html><body><p>" +
+		strings.ReplaceAll(html.EscapeString(msg.Text), "\n", "<br>") +
+		"</p></body></html>"
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", htmlBody},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(p.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// wrapSMTPError превращает ответ сервера с кодом в *Error,
+// остальные (сетевые) ошибки оставляет как есть — они считаются временными.
+func wrapSMTPError(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return &Error{Code: tpErr.Code, Msg: tpErr.Msg}
+	}
+	return fmt.Errorf("email: %w", err)
+}
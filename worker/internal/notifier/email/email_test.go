@@ -0,0 +1,191 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+// smtpStub — минимальный SMTP-сервер в процессе теста. Отвечает на команды
+// заранее заданными кодами и сохраняет принятое письмо.
+type smtpStub struct {
+	addr     string
+	rcptCode string // ответ на RCPT TO, по умолчанию "250 OK"
+	authSeen bool
+	data     chan string
+}
+
+func newSMTPStub(t *testing.T, rcptCode string) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &smtpStub{addr: ln.Addr().String(), rcptCode: rcptCode, data: make(chan string, 1)}
+	if s.rcptCode == "" {
+		s.rcptCode = "250 OK"
+	}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s.serve(conn)
+	}()
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP stub")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH"):
+			s.authSeen = true
+			reply("235 Authentication successful")
+		case strings.HasPrefix(cmd, "MAIL"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT"):
+			reply(s.rcptCode)
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var sb strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				sb.WriteString(l)
+			}
+			s.data <- sb.String()
+			reply("250 OK queued")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestNotifier_Send_MultipartMessage(t *testing.T) {
+	stub := newSMTPStub(t, "")
+	n := NewNotifier(Config{
+		Addr:     stub.addr,
+		Username: "user",
+		Password: "secret",
+		From:     "noreply@example.com",
+		Subject:  "Напоминание",
+	})
+
+	err := n.Send(context.Background(), domain.Message{
+		Id:    "msg-1",
+		Text:  "line <1>\nline 2",
+		Email: "user@example.com",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	raw := <-stub.data
+	if !stub.authSeen {
+		t.Fatalf("expected AUTH to be used when username is set")
+	}
+	m, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("failed to parse sent message: %v", err)
+	}
+	if m.Header.Get("To") != "user@example.com" {
+		t.Fatalf("unexpected To header: %q", m.Header.Get("To"))
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %q (%v)", mediaType, err)
+	}
+
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	var types []string
+	var htmlBody string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(p) // multipart.Reader сам декодирует quoted-printable
+		ct := p.Header.Get("Content-Type")
+		types = append(types, ct)
+		if strings.HasPrefix(ct, "text/html") {
+			htmlBody = string(body)
+		}
+	}
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Fatalf("expected text/plain and text/html parts, got %v", types)
+	}
+	if !strings.Contains(htmlBody, "line &lt;1&gt;<br>line 2") {
+		t.Fatalf("expected escaped html body, got %q", htmlBody)
+	}
+}
+
+func TestNotifier_Send_ErrorClassification(t *testing.T) {
+	cases := []struct {
+		name      string
+		rcptCode  string
+		temporary bool
+	}{
+		{"mailbox unavailable", "550 No such user", false},
+		{"greylisted", "451 Try again later", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := newSMTPStub(t, tc.rcptCode)
+			n := NewNotifier(Config{Addr: stub.addr, From: "noreply@example.com"})
+
+			err := n.Send(context.Background(), domain.Message{Id: "msg-1", Text: "hi", Email: "user@example.com"})
+
+			var smtpErr *Error
+			if !errors.As(err, &smtpErr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if smtpErr.Temporary() != tc.temporary {
+				t.Fatalf("expected temporary=%v for %s, got %v", tc.temporary, tc.rcptCode, smtpErr.Temporary())
+			}
+		})
+	}
+}
+
+func TestNotifier_Send_NoRecipient(t *testing.T) {
+	n := NewNotifier(Config{Addr: "127.0.0.1:1", From: "noreply@example.com"})
+
+	err := n.Send(context.Background(), domain.Message{Id: "msg-1", Text: "hi"})
+	if !errors.Is(err, ErrNoRecipient) || ErrNoRecipient.Temporary() {
+		t.Fatalf("expected permanent ErrNoRecipient, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package notifier
+
+import (
+	"fmt"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+// Registry хранит notifier'ы по имени канала. Воркер выбирает по нему,
+// куда доставить сообщение, поэтому новый канал добавляется регистрацией,
+// без изменений в цикле консьюмера.
+type Registry struct {
+	notifiers map[string]port.Notifier
+}
+
+func NewRegistry(notifiers ...port.Notifier) *Registry {
+	r := &Registry{notifiers: make(map[string]port.Notifier, len(notifiers))}
+	for _, n := range notifiers {
+		r.Register(n)
+	}
+	return r
+}
+
+// Register добавляет notifier; повторная регистрация канала заменяет предыдущий.
+func (r *Registry) Register(n port.Notifier) {
+	r.notifiers[n.Channel()] = n
+}
+
+// Get возвращает notifier для канала или ошибку, если канал не зарегистрирован.
+func (r *Registry) Get(channel string) (port.Notifier, error) {
+	n, ok := r.notifiers[channel]
+	if !ok {
+		return nil, &UnknownChannelError{Channel: channel}
+	}
+	return n, nil
+}
+
+// UnknownChannelError — для канала сообщения нет зарегистрированного notifier'а.
+// Повторять такую доставку бессмысленно.
+type UnknownChannelError struct {
+	Channel string
+}
+
+func (e *UnknownChannelError) Error() string {
+	return fmt.Sprintf("no notifier registered for channel %q", e.Channel)
+}
+
+func (e *UnknownChannelError) Temporary() bool {
+	return false
+}
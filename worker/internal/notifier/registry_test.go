@@ -0,0 +1,43 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+type notifierStub struct {
+	channel string
+}
+
+func (n *notifierStub) Channel() string {
+	return n.channel
+}
+
+func (n *notifierStub) Send(ctx context.Context, message domain.Message) error {
+	return nil
+}
+
+func TestRegistry_Get(t *testing.T) {
+	tg := &notifierStub{channel: domain.ChannelTelegram}
+	r := NewRegistry(tg)
+
+	n, err := r.Get(domain.ChannelTelegram)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if n != tg {
+		t.Fatalf("expected registered notifier to be returned")
+	}
+
+	_, err = r.Get("pigeon")
+	var unknown *UnknownChannelError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("expected UnknownChannelError, got %v", err)
+	}
+	if unknown.Temporary() {
+		t.Fatalf("unknown channel must not be retried")
+	}
+}
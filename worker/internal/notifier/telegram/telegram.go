@@ -0,0 +1,165 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+// DefaultBaseURL — адрес Telegram Bot API по умолчанию.
+const DefaultBaseURL = "https://api.telegram.org"
+
+const defaultTimeout = 10 * time.Second
+
+var (
+	// ErrTooManyRequests — Telegram ограничил частоту запросов (429).
+	ErrTooManyRequests = errors.New("telegram: too many requests")
+	// ErrBadChat — чат не найден или запрос некорректен (400).
+	ErrBadChat = errors.New("telegram: bad chat")
+	// ErrBlocked — пользователь заблокировал бота (403).
+	ErrBlocked = errors.New("telegram: bot was blocked by the user")
+)
+
+// Error — ошибка, которую вернул Telegram Bot API.
+type Error struct {
+	Code              int
+	Description       string
+	RetryAfterSeconds int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("telegram: %d %s", e.Code, e.Description)
+}
+
+// Unwrap позволяет сравнивать ошибку с ErrTooManyRequests/ErrBadChat/ErrBlocked через errors.Is.
+func (e *Error) Unwrap() error {
+	switch e.Code {
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case http.StatusBadRequest:
+		return ErrBadChat
+	case http.StatusForbidden:
+		return ErrBlocked
+	}
+	return nil
+}
+
+// RetryAfter — сколько Telegram просит подождать перед следующей попыткой.
+func (e *Error) RetryAfter() time.Duration {
+	return time.Duration(e.RetryAfterSeconds) * time.Second
+}
+
+// Temporary сообщает, имеет ли смысл повторять отправку.
+// Повторяем только 429 и ошибки на стороне Telegram (5xx).
+func (e *Error) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= http.StatusInternalServerError
+}
+
+// ResponseCode и ResponseBody попадают в историю попыток доставки.
+func (e *Error) ResponseCode() int {
+	return e.Code
+}
+
+func (e *Error) ResponseBody() string {
+	return e.Description
+}
+
+var _ port.Notifier = (*Notifier)(nil)
+
+// Notifier отправляет сообщения через метод sendMessage Telegram Bot API.
+type Notifier struct {
+	token   string
+	baseURL string
+	client  *http.Client
+}
+
+func NewNotifier(token, baseURL string) *Notifier {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Notifier{
+		token:   token,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+type sendMessageRequest struct {
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+type apiResponse struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (n *Notifier) Channel() string {
+	return domain.ChannelTelegram
+}
+
+// Send отправляет текст сообщения в msg.TelegramChatId.
+// nil возвращается только после того, как Telegram подтвердил доставку (ok=true).
+func (n *Notifier) Send(ctx context.Context, msg domain.Message) error {
+	body, err := json.Marshal(sendMessageRequest{
+		ChatID: int64(msg.TelegramChatId),
+		Text:   msg.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", n.baseURL, n.token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		// ошибка разбора тоже содержит адрес с токеном
+		return errors.New("telegram: invalid base URL")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// *url.Error содержит адрес запроса, а с ним и токен бота: в логи и историю
+		// попыток уходит только причина
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var apiResp apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		// тело не в формате Bot API (например, страница балансировщика) —
+		// ориентируемся только на HTTP-код
+		return &Error{Code: resp.StatusCode, Description: resp.Status}
+	}
+
+	if resp.StatusCode == http.StatusOK && apiResp.Ok {
+		return nil
+	}
+
+	code := apiResp.ErrorCode
+	if code == 0 {
+		code = resp.StatusCode
+	}
+	return &Error{
+		Code:              code,
+		Description:       apiResp.Description,
+		RetryAfterSeconds: apiResp.Parameters.RetryAfter,
+	}
+}
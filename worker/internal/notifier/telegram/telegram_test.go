@@ -0,0 +1,124 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+// newTelegramStub поднимает локальную заглушку Bot API, которая отвечает
+// заданным HTTP-кодом и телом и запоминает последний запрос.
+func newTelegramStub(t *testing.T, code int, body string, got *sendMessageRequest) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottest-token/sendMessage" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got != nil {
+			_ = json.NewDecoder(r.Body).Decode(got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestNotifier_Send_OK(t *testing.T) {
+	var got sendMessageRequest
+	srv := newTelegramStub(t, http.StatusOK, `{"ok":true,"result":{"message_id":1}}`, &got)
+
+	s := NewNotifier("test-token", srv.URL)
+	err := s.Send(context.Background(), domain.Message{Text: "hello", TelegramChatId: 42})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got.ChatID != 42 || got.Text != "hello" {
+		t.Fatalf("unexpected request payload: %+v", got)
+	}
+}
+
+func TestNotifier_Send_TooManyRequests(t *testing.T) {
+	srv := newTelegramStub(t, http.StatusTooManyRequests,
+		`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`, nil)
+
+	err := NewNotifier("test-token", srv.URL).Send(context.Background(), domain.Message{TelegramChatId: 1})
+
+	var tgErr *Error
+	if !errors.As(err, &tgErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("expected ErrTooManyRequests, got %v", err)
+	}
+	if !tgErr.Temporary() {
+		t.Fatalf("429 must be temporary")
+	}
+	if tgErr.RetryAfter() != 7*time.Second {
+		t.Fatalf("expected retry after 7s, got %s", tgErr.RetryAfter())
+	}
+}
+
+func TestNotifier_Send_PermanentErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		code int
+		body string
+		want error
+	}{
+		{"bad chat", http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, ErrBadChat},
+		{"blocked", http.StatusForbidden, `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`, ErrBlocked},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newTelegramStub(t, tc.code, tc.body, nil)
+
+			err := NewNotifier("test-token", srv.URL).Send(context.Background(), domain.Message{TelegramChatId: 1})
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, err)
+			}
+			var tgErr *Error
+			if !errors.As(err, &tgErr) || tgErr.Temporary() {
+				t.Fatalf("expected permanent *Error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNotifier_Send_ServerErrorIsTemporary(t *testing.T) {
+	srv := newTelegramStub(t, http.StatusBadGateway, `<html>bad gateway</html>`, nil)
+
+	err := NewNotifier("test-token", srv.URL).Send(context.Background(), domain.Message{TelegramChatId: 1})
+
+	var tgErr *Error
+	if !errors.As(err, &tgErr) || !tgErr.Temporary() {
+		t.Fatalf("expected temporary *Error, got %v", err)
+	}
+}
+
+func TestNotifier_Send_RequestErrorHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close() // соединение будет отклонено
+
+	err := NewNotifier("secret-token", srv.URL).Send(context.Background(), domain.Message{TelegramChatId: 1})
+	if err == nil {
+		t.Fatalf("expected request error")
+	}
+	if strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("error must not contain the bot token: %v", err)
+	}
+
+	err = NewNotifier("secret-token", "http://bad host").Send(context.Background(), domain.Message{TelegramChatId: 1})
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("expected error without the bot token, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress — адрес получателя во внутренней сети: воркер туда не ходит,
+// иначе через webhook_url можно достучаться до метаданных облака, localhost и admin‑портов.
+var ErrForbiddenAddress = errors.New("webhook: destination address is not allowed")
+
+// forbiddenPrefixes дополняют проверки netip: сети, которые не считаются частными,
+// но снаружи недоступны.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // CGNAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// allowedAddr сообщает, можно ли отправить webhook на адрес.
+func allowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, p := range forbiddenPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicDialer проверяет адрес уже после резолва, перед самим соединением: так
+// имя, которое резолвится во внутренний адрес (в том числе при DNS rebinding), не пройдёт.
+func publicDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !allowedAddr(addr) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+const (
+	HeaderSignature  = "X-Signature"
+	HeaderTimestamp  = "X-Timestamp"
+	HeaderDeliveryID = "X-Delivery-Id"
+
+	defaultTimeout = 10 * time.Second
+	// сколько байт ответа сохраняем в ошибке для диагностики
+	maxBodyExcerpt = 512
+)
+
+// Error — получатель ответил кодом, отличным от 2xx.
+// 5xx считаются временными, остальные (4xx, 3xx) — постоянными.
+type Error struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("webhook: unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+func (e *Error) Temporary() bool {
+	return e.StatusCode >= http.StatusInternalServerError
+}
+
+// ResponseCode и ResponseBody попадают в историю попыток доставки.
+func (e *Error) ResponseCode() int {
+	return e.StatusCode
+}
+
+func (e *Error) ResponseBody() string {
+	return e.Body
+}
+
+// Sign возвращает значение заголовка X-Signature: HMAC-SHA256 от
+// "<timestamp>.<body>" в hex с префиксом "sha256=".
+// Получатель проверяет подпись тем же секретом.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var _ port.Notifier = (*Notifier)(nil)
+
+// Notifier отправляет POST-запрос на WebhookURL сообщения.
+type Notifier struct {
+	secret []byte
+	client *http.Client
+}
+
+// NewNotifier создаёт notifier, который не ходит во внутренние сети (см. ErrForbiddenAddress);
+// allowPrivate снимает запрет — для локальной разработки и получателей внутри периметра.
+func NewNotifier(secret string, timeout time.Duration, allowPrivate bool) *Notifier {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		// через прокси проверялся бы адрес прокси, а не получателя
+		transport.Proxy = nil
+		transport.DialContext = publicDialer(timeout).DialContext
+	}
+	return &Notifier{
+		secret: []byte(secret),
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// редирект на POST-запрос не повторяем: 3xx вернётся как есть
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (n *Notifier) Channel() string {
+	return domain.ChannelWebhook
+}
+
+type defaultPayload struct {
+	Id          string    `json:"id"`
+	Text        string    `json:"text"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	UserId      uint32    `json:"user_id"`
+}
+
+// Send отправляет WebhookBody сообщения (или id/text, если тело не задано)
+// с пользовательскими заголовками и подписью. Успех — только ответ 2xx.
+func (n *Notifier) Send(ctx context.Context, msg domain.Message) error {
+	body := []byte(msg.WebhookBody)
+	if len(body) == 0 {
+		var err error
+		body, err = json.Marshal(defaultPayload{
+			Id:          msg.Id,
+			Text:        msg.Text,
+			ScheduledAt: msg.ScheduledAt,
+			UserId:      msg.UserId,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		// некорректный URL не исправится ретраями
+		return &Error{StatusCode: http.StatusBadRequest, Body: err.Error()}
+	}
+	for k, v := range msg.WebhookHeaders {
+		req.Header.Set(k, v)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderDeliveryID, msg.Id)
+	req.Header.Set(HeaderSignature, Sign(n.secret, timestamp, body))
+
+	resp, err := n.client.Do(req)
+	if errors.Is(err, ErrForbiddenAddress) {
+		// адрес не станет разрешённым от повтора
+		return &Error{StatusCode: http.StatusForbidden, Body: ErrForbiddenAddress.Error()}
+	}
+	if err != nil {
+		// сетевые ошибки и таймауты ретраятся
+		return fmt.Errorf("webhook: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxBodyExcerpt))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return &Error{StatusCode: resp.StatusCode, Body: string(excerpt)}
+}
@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+func TestNotifier_Send_SignedRequest(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	n := NewNotifier("top-secret", time.Second, true)
+	err := n.Send(context.Background(), domain.Message{
+		Id:             "msg-1",
+		WebhookURL:     srv.URL + "/hook",
+		WebhookHeaders: map[string]string{"Authorization": "Bearer abc"},
+		WebhookBody:    []byte(`{"action":"ping"}`),
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if string(gotBody) != `{"action":"ping"}` {
+		t.Fatalf("unexpected body %s", gotBody)
+	}
+	if gotHeader.Get("Authorization") != "Bearer abc" {
+		t.Fatalf("expected custom header to be passed")
+	}
+	if gotHeader.Get(HeaderDeliveryID) != "msg-1" {
+		t.Fatalf("expected delivery id header, got %q", gotHeader.Get(HeaderDeliveryID))
+	}
+	want := Sign([]byte("top-secret"), gotHeader.Get(HeaderTimestamp), gotBody)
+	if gotHeader.Get(HeaderSignature) != want {
+		t.Fatalf("signature mismatch: got %q, want %q", gotHeader.Get(HeaderSignature), want)
+	}
+}
+
+func TestNotifier_Send_ErrorClassification(t *testing.T) {
+	cases := []struct {
+		name      string
+		code      int
+		temporary bool
+	}{
+		{"server error", http.StatusServiceUnavailable, true},
+		{"client error", http.StatusNotFound, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.code)
+			}))
+			defer srv.Close()
+
+			err := NewNotifier("s", time.Second, true).Send(context.Background(), domain.Message{Id: "1", WebhookURL: srv.URL})
+
+			var whErr *Error
+			if !errors.As(err, &whErr) {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if whErr.Temporary() != tc.temporary {
+				t.Fatalf("expected temporary=%v for %d", tc.temporary, tc.code)
+			}
+		})
+	}
+}
+
+func TestNotifier_Send_TimeoutIsRetried(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	err := NewNotifier("s", 50*time.Millisecond, true).Send(context.Background(), domain.Message{Id: "1", WebhookURL: srv.URL})
+	if err == nil {
+		t.Fatalf("expected timeout error")
+	}
+	var whErr *Error
+	if errors.As(err, &whErr) {
+		t.Fatalf("timeout must not be classified as a terminal status error: %v", err)
+	}
+}
+
+func TestNotifier_Send_RejectsPrivateAddress(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer srv.Close()
+
+	// httptest слушает loopback — как admin‑порт воркера или сервис внутри сети
+	err := NewNotifier("s", time.Second, false).Send(context.Background(), domain.Message{Id: "1", WebhookURL: srv.URL})
+	var whErr *Error
+	if !errors.As(err, &whErr) || whErr.Temporary() {
+		t.Fatalf("expected terminal error for loopback destination, got %v", err)
+	}
+	if hit {
+		t.Fatalf("request must not reach a loopback destination")
+	}
+}
+
+func TestAllowedAddr(t *testing.T) {
+	cases := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"0.0.0.0":          false,
+		"100.64.0.1":       false,
+		"::ffff:127.0.0.1": false,
+	}
+	for addr, want := range cases {
+		if got := allowedAddr(netip.MustParseAddr(addr)); got != want {
+			t.Fatalf("allowedAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
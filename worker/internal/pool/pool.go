@@ -0,0 +1,86 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed — пул закрыт и новых задач не принимает.
+var ErrClosed = errors.New("pool: closed")
+
+// Pool выполняет задачи фиксированным числом обработчиков. Задачи сверх них ждут
+// в очереди ограниченной длины; когда и она заполнена, Submit блокируется.
+type Pool struct {
+	tasks   chan func()
+	workers int
+
+	inFlight atomic.Int64
+	queued   atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Stats — снимок загрузки пула.
+type Stats struct {
+	Workers  int   `json:"workers"`
+	InFlight int64 `json:"in_flight"`
+	Queued   int64 `json:"queued"`
+}
+
+// New запускает workers обработчиков с очередью на queue задач.
+func New(workers, queue int) *Pool {
+	p := &Pool{tasks: make(chan func(), queue), workers: workers}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		p.queued.Add(-1)
+		p.inFlight.Add(1)
+		task()
+		p.inFlight.Add(-1)
+	}
+}
+
+// Submit ставит задачу в очередь. Если очередь заполнена, ждёт места или отмены ctx.
+func (p *Pool) Submit(ctx context.Context, task func()) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+
+	p.queued.Add(1)
+	select {
+	case p.tasks <- task:
+		return nil
+	case <-ctx.Done():
+		p.queued.Add(-1)
+		return ctx.Err()
+	}
+}
+
+// Stats возвращает число обработчиков, выполняемых и ожидающих задач.
+func (p *Pool) Stats() Stats {
+	return Stats{Workers: p.workers, InFlight: p.inFlight.Load(), Queued: p.queued.Load()}
+}
+
+// Close перестаёт принимать задачи и ждёт, пока обработчики выполнят уже принятые.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
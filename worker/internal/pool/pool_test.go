@@ -0,0 +1,100 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_BoundsConcurrency(t *testing.T) {
+	p := New(2, 10)
+
+	var running, peak atomic.Int64
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		err := p.Submit(context.Background(), func() {
+			defer wg.Done()
+			n := running.Add(1)
+			for {
+				m := peak.Load()
+				if n <= m || peak.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			<-release
+			running.Add(-1)
+		})
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+
+	waitFor(t, func() bool { return p.Stats().InFlight == 2 })
+	if s := p.Stats(); s.Workers != 2 || s.Queued != 4 {
+		t.Fatalf("expected 2 workers busy and 4 queued, got %+v", s)
+	}
+
+	close(release)
+	wg.Wait()
+	if peak.Load() != 2 {
+		t.Fatalf("expected at most 2 concurrent tasks, got %d", peak.Load())
+	}
+	p.Close()
+	if s := p.Stats(); s.InFlight != 0 || s.Queued != 0 {
+		t.Fatalf("expected idle pool, got %+v", s)
+	}
+}
+
+func TestPool_SubmitWaitsForRoom(t *testing.T) {
+	p := New(1, 1)
+	defer p.Close()
+
+	release := make(chan struct{})
+	block := func() { <-release }
+	_ = p.Submit(context.Background(), block)
+	waitFor(t, func() bool { return p.Stats().InFlight == 1 })
+	_ = p.Submit(context.Background(), block)
+
+	// обработчик занят, очередь заполнена: Submit ждёт, пока ctx не отменят
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(ctx, block); err != context.DeadlineExceeded {
+		t.Fatalf("expected submit to block until deadline, got %v", err)
+	}
+	if s := p.Stats(); s.Queued != 1 {
+		t.Fatalf("rejected task must not stay queued, got %+v", s)
+	}
+	close(release)
+}
+
+func TestPool_CloseRejectsAndWaits(t *testing.T) {
+	p := New(1, 1)
+	var done atomic.Bool
+	_ = p.Submit(context.Background(), func() {
+		time.Sleep(10 * time.Millisecond)
+		done.Store(true)
+	})
+
+	p.Close()
+	if !done.Load() {
+		t.Fatalf("expected Close to wait for accepted tasks")
+	}
+	if err := p.Submit(context.Background(), func() {}); err != ErrClosed {
+		t.Fatalf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
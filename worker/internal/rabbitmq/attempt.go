@@ -0,0 +1,82 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+)
+
+const (
+	// maxAttemptText — сколько байт ответа и текста ошибки хранится в истории попыток.
+	maxAttemptText = 512
+	// attemptWriteTimeout — запись попытки переживает остановку воркера, но не дольше этого.
+	attemptWriteTimeout = 5 * time.Second
+)
+
+// recordAttempt сохраняет результат попытки доставки. Ошибка записи не прерывает доставку.
+func (c *MessageQueueConsumer) recordAttempt(ctx context.Context, msg *domain.Message, started time.Time, sendErr error) {
+	attempt := newAttempt(msg, started, time.Now(), sendErr)
+
+	// прерванную остановкой попытку тоже нужно записать
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), attemptWriteTimeout)
+	defer cancel()
+	if _, err := c.repo.RecordAttempt(ctx, attempt); err != nil {
+		log.Printf("failed to record delivery attempt for message %s: %v", msg.Id, err)
+	}
+}
+
+func newAttempt(msg *domain.Message, started, finished time.Time, sendErr error) domain.DeliveryAttempt {
+	attempt := domain.DeliveryAttempt{
+		MessageId:  msg.Id,
+		Channel:    msg.Channel,
+		StartedAt:  started,
+		FinishedAt: finished,
+		Outcome:    domain.AttemptSucceeded,
+	}
+	if sendErr == nil {
+		return attempt
+	}
+	attempt.Outcome = domain.AttemptFailed
+	attempt.ErrorClass = errorClass(sendErr)
+	attempt.Error = excerpt(sendErr.Error())
+
+	var resp interface {
+		ResponseCode() int
+		ResponseBody() string
+	}
+	if errors.As(sendErr, &resp) {
+		attempt.ResponseCode = resp.ResponseCode()
+		attempt.ResponseBody = excerpt(resp.ResponseBody())
+	}
+	return attempt
+}
+
+// errorClass относит ошибку отправки к одному из domain.ErrorClass*.
+func errorClass(err error) string {
+	var timeout interface{ Timeout() bool }
+	switch {
+	case errors.Is(err, context.Canceled):
+		return domain.ErrorClassCancelled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &timeout) && timeout.Timeout():
+		return domain.ErrorClassTimeout
+	case isTemporary(err):
+		return domain.ErrorClassTemporary
+	}
+	return domain.ErrorClassPermanent
+}
+
+// excerpt обрезает строку до maxAttemptText байт, не разрывая символ UTF-8.
+func excerpt(s string) string {
+	if len(s) <= maxAttemptText {
+		return s
+	}
+	n := maxAttemptText
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
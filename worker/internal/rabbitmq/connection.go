@@ -0,0 +1,166 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	rabbitAdapter "github.com/dontpanicw/DelayedNotifier/internal/adapter/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+var errConnectionLost = errors.New("delivery channel closed")
+
+// dialer открывает соединение и каналы воркера с уже объявленной топологией.
+type dialer func() (conn io.Closer, ch, dlq amqpChannel, pub publisher, err error)
+
+// dialRabbit подключается к RabbitMQ и объявляет exchange, очереди и привязки:
+// после перезапуска брокера без персистентности их может не оказаться.
+func dialRabbit(rabbitURL string, delayBuckets bool) dialer {
+	return func() (io.Closer, amqpChannel, amqpChannel, publisher, error) {
+		conn, err := amqp.Dial(rabbitURL)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		ch, err := conn.Channel()
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, nil, nil, err
+		}
+		dlq, err := conn.Channel()
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, nil, nil, err
+		}
+		if err := declareTopology(ch, delayBuckets); err != nil {
+			_ = conn.Close()
+			return nil, nil, nil, nil, err
+		}
+		return conn, ch, dlq, newConfirmPublisher(conn), nil
+	}
+}
+
+func declareTopology(ch *amqp.Channel, delayBuckets bool) error {
+	if err := ch.ExchangeDeclare(
+		workerExchangeName,
+		"direct",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	); err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDeclare(rabbitAdapter.DeadLetterQueueName, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	q, err := ch.QueueDeclare(
+		workerQueueName,
+		true,
+		false,
+		false,
+		false,
+		rabbitAdapter.MainQueueArgs(),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := ch.QueueBind(
+		q.Name,
+		workerRoutingKey,
+		workerExchangeName,
+		false,
+		nil,
+	); err != nil {
+		return err
+	}
+
+	if delayBuckets {
+		return declareDelayQueues(ch)
+	}
+	return nil
+}
+
+// connect открывает новое соединение и делает его текущим.
+func (c *MessageQueueConsumer) connect() error {
+	conn, ch, dlq, pub, err := c.dial()
+	if err != nil {
+		return err
+	}
+	c.connMu.Lock()
+	c.conn, c.ch, c.dlq, c.pub = conn, ch, dlq, pub
+	c.connMu.Unlock()
+	c.connected.Store(true)
+	return nil
+}
+
+// reconnect закрывает потерянное соединение и подключается заново, удваивая паузу
+// между попытками. false — ctx отменён раньше, чем соединение восстановлено.
+func (c *MessageQueueConsumer) reconnect(ctx context.Context) bool {
+	c.closeConnection()
+	delay := c.reconnectDelay
+	if delay <= 0 {
+		delay = reconnectMinDelay
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		err := c.connect()
+		if err == nil {
+			log.Printf("RabbitMQ connection restored")
+			return true
+		}
+		log.Printf("failed to reconnect to RabbitMQ, retrying in %s: %v", delay, err)
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+// channels возвращает каналы текущего соединения.
+func (c *MessageQueueConsumer) channels() (ch, dlq amqpChannel) {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.ch, c.dlq
+}
+
+// publisher возвращает публикации текущего соединения.
+func (c *MessageQueueConsumer) publisher() publisher {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.pub
+}
+
+func (c *MessageQueueConsumer) closeConnection() {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.pub != nil {
+		_ = c.pub.Close()
+	}
+	if c.dlq != nil {
+		_ = c.dlq.Close()
+	}
+	if c.ch != nil {
+		_ = c.ch.Close()
+	}
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+}
+
+// Connected сообщает, есть ли сейчас соединение с RabbitMQ.
+func (c *MessageQueueConsumer) Connected() bool {
+	return c.connected.Load()
+}
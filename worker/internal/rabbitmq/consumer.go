@@ -3,11 +3,19 @@ package rabbitmq
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	rabbitAdapter "github.com/dontpanicw/DelayedNotifier/internal/adapter/rabbitmq"
 	"github.com/dontpanicw/DelayedNotifier/internal/domain"
 	"github.com/dontpanicw/DelayedNotifier/internal/port"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/notifier"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/pool"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -15,90 +23,162 @@ const (
 	workerExchangeName = "notifications.exchange"
 	workerQueueName    = "notifications.queue"
 	workerRoutingKey   = "notifications.create"
+
+	workerConsumerTag = "delayed_notifier_worker"
+	dlqConsumerTag    = "delayed_notifier_dlq"
 )
 
-// retryDelays задаёт экспоненциальную политику ретраев:
-// первая попытка сразу, затем 10с, 40с, 90с.
-var retryDelays = []time.Duration{
-	10 * time.Second,
-	40 * time.Second,
-	90 * time.Second,
+// amqpChannel — операции канала RabbitMQ, которыми пользуется consumer (*amqp.Channel).
+type amqpChannel interface {
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	Close() error
+}
+
+// Concurrency — пулы обработчиков доставки.
+type Concurrency struct {
+	// Workers — общий пул для каналов без своего лимита.
+	Workers int
+	// Channels — свой пул канала: медленный провайдер не занимает общий.
+	Channels map[string]int
+	// Prefetch — лимит неподтверждённых сообщений (Qos); 0 — общее число обработчиков.
+	Prefetch int
 }
 
 type MessageQueueConsumer struct {
-	conn  *amqp.Connection
-	ch    *amqp.Channel
-	repo  port.Repository
-	cache port.StatusCache
+	// dial подключается заново после потери соединения.
+	dial dialer
+	// connMu защищает текущие соединение и каналы: после переподключения их меняет Start.
+	connMu sync.RWMutex
+	conn   io.Closer
+	ch     amqpChannel
+	// dlq — отдельный канал для DLQ, чтобы Qos основной очереди его не касался.
+	dlq amqpChannel
+	// pub — публикации с подтверждением: в очереди ожидания и в DLQ.
+	pub       publisher
+	connected atomic.Bool
+	// reconnectDelay — первая пауза перед переподключением; 0 — reconnectMinDelay.
+	reconnectDelay time.Duration
+
+	repo       port.Repository
+	cache      port.StatusCache
+	notifiers  *notifier.Registry
+	recurrence port.Recurrence
+	// delayBuckets — недождавшиеся сообщения перекладываются в очереди ожидания
+	// вместо таймера в памяти (SCHEDULER_MODE=broker).
+	delayBuckets bool
+	// lease — срок захвата сообщения перед отправкой (см. ClaimMessage).
+	lease time.Duration
+	// cancels — рассылка отмен; nil — отменённое сообщение отсеет только захват.
+	cancels port.CancelBus
+	// policies — политики повторов доставки по сообщению и каналу.
+	policies domain.RetryPolicies
+
+	// prefetch — Qos канала; очереди пулов не короче, поэтому приём не блокируется.
+	prefetch int
+	shared   *pool.Pool
+	lanes    map[string]*pool.Pool
+
+	// stopping закрывается, когда воркер перестаёт принимать сообщения: ожидающие
+	// срока и ещё не начатые доставки возвращаются брокеру.
+	stopping chan struct{}
+	// abort прерывает доставки, не успевшие завершиться за время drain (см. Shutdown).
+	abort     context.CancelFunc
+	recording sync.WaitGroup
+	// timers — горутины, ждущие срока сообщений до передачи пулу (режим timer).
+	timers sync.WaitGroup
+
+	mu sync.Mutex
+	// waiting — прерывание ожидания срока для сообщений, которые держит этот воркер.
+	// У одного id может быть несколько доставок (копии после изменения или повторной публикации).
+	waiting map[string]map[*waiter]struct{}
 }
 
-func NewMessageQueueConsumer(rabbitURL string, repo port.Repository, cache port.StatusCache) (*MessageQueueConsumer, error) {
-	conn, err := amqp.Dial(rabbitURL)
-	if err != nil {
-		return nil, err
+// waiter — ожидание срока одной доставки.
+type waiter struct {
+	cancel context.CancelFunc
+}
+
+func NewMessageQueueConsumer(rabbitURL string, repo port.Repository, cache port.StatusCache, notifiers *notifier.Registry, recurrence port.Recurrence, delayBuckets bool, lease time.Duration, cancels port.CancelBus, policies domain.RetryPolicies, concurrency Concurrency) (*MessageQueueConsumer, error) {
+	prefetch := concurrency.Prefetch
+	if prefetch <= 0 {
+		prefetch = concurrency.Workers
+		for _, n := range concurrency.Channels {
+			prefetch += n
+		}
 	}
-	ch, err := conn.Channel()
-	if err != nil {
-		_ = conn.Close()
-		return nil, err
+	lanes := make(map[string]*pool.Pool, len(concurrency.Channels))
+	for channel, n := range concurrency.Channels {
+		lanes[channel] = pool.New(n, prefetch)
 	}
 
-	if err := ch.ExchangeDeclare(
-		workerExchangeName,
-		"direct",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	); err != nil {
-		_ = ch.Close()
-		_ = conn.Close()
-		return nil, err
+	c := &MessageQueueConsumer{
+		dial:         dialRabbit(rabbitURL, delayBuckets),
+		repo:         repo,
+		cache:        cache,
+		notifiers:    notifiers,
+		recurrence:   recurrence,
+		delayBuckets: delayBuckets,
+		lease:        lease,
+		cancels:      cancels,
+		policies:     policies,
+		prefetch:     prefetch,
+		shared:       pool.New(concurrency.Workers, prefetch),
+		lanes:        lanes,
+		stopping:     make(chan struct{}),
+		waiting:      make(map[string]map[*waiter]struct{}),
 	}
-
-	q, err := ch.QueueDeclare(
-		workerQueueName,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		_ = ch.Close()
-		_ = conn.Close()
+	// первое подключение не повторяется: ошибка конфигурации видна сразу
+	if err := c.connect(); err != nil {
+		c.closePools()
 		return nil, err
 	}
+	return c, nil
+}
 
-	if err := ch.QueueBind(
-		q.Name,
-		workerRoutingKey,
-		workerExchangeName,
-		false,
-		nil,
-	); err != nil {
-		_ = ch.Close()
-		_ = conn.Close()
-		return nil, err
+// Start принимает сообщения, пока не отменён ctx, затем перестаёт их принимать
+// и возвращает брокеру ещё не переданные пулу. Начатые доставки ctx не прерывает:
+// их дожидается Shutdown. Потерянное соединение восстанавливается с паузами.
+func (c *MessageQueueConsumer) Start(ctx context.Context) error {
+	work, abort := context.WithCancel(context.WithoutCancel(ctx))
+	c.abort = abort
+
+	if c.cancels != nil {
+		ids, err := c.cancels.SubscribeCancel(ctx)
+		if err != nil {
+			// не критично: отменённое сообщение не пройдёт захват перед отправкой
+			log.Printf("failed to subscribe to cancellations: %v", err)
+		} else {
+			go c.watchCancels(ids)
+		}
 	}
 
-	return &MessageQueueConsumer{
-		conn:  conn,
-		ch:    ch,
-		repo:  repo,
-		cache: cache,
-	}, nil
+	for {
+		err := c.consume(ctx, work)
+		if err == nil {
+			return nil
+		}
+		c.connected.Store(false)
+		log.Printf("RabbitMQ connection lost: %v", err)
+		if !c.reconnect(ctx) {
+			close(c.stopping)
+			return nil
+		}
+	}
 }
 
-func (c *MessageQueueConsumer) Start(ctx context.Context) error {
-	if err := c.ch.Qos(1, 0, false); err != nil {
+// consume принимает сообщения текущего соединения. nil — остановка по ctx,
+// ошибка — соединение или канал потеряны.
+func (c *MessageQueueConsumer) consume(ctx, work context.Context) error {
+	ch, dlq := c.channels()
+	if err := ch.Qos(c.prefetch, 0, false); err != nil {
 		return err
 	}
 
-	msgs, err := c.ch.Consume(
+	msgs, err := ch.Consume(
 		workerQueueName,
-		"delayed_notifier_worker",
+		workerConsumerTag,
 		false,
 		false,
 		false,
@@ -109,106 +189,449 @@ func (c *MessageQueueConsumer) Start(ctx context.Context) error {
 		return err
 	}
 
+	deadLetters, err := dlq.Consume(rabbitAdapter.DeadLetterQueueName, dlqConsumerTag, false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	// запись в БД и Ack должны успеть до закрытия канала, поэтому контекст без отмены
+	c.recording.Add(1)
+	go func() {
+		defer c.recording.Done()
+		c.recordDeadLetters(context.WithoutCancel(ctx), deadLetters)
+	}()
+
+	// lost закрывается при потере соединения: брокер уже вернул в очередь всё
+	// неподтверждённое, и задачи этого соединения, не начавшие отправку, сходят с дистанции
+	lost := make(chan struct{})
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			c.stop(msgs)
+			return nil
 		case d, ok := <-msgs:
 			if !ok {
-				return nil
+				close(lost)
+				return errConnectionLost
 			}
-			go c.handleDelivery(ctx, d)
+			c.dispatch(work, d, lost)
+		}
+	}
+}
+
+// stop отменяет подписки и возвращает брокеру сообщения, которые он успел отдать,
+// но воркер ещё не принял в работу.
+func (c *MessageQueueConsumer) stop(msgs <-chan amqp.Delivery) {
+	close(c.stopping)
+	ch, dlq := c.channels()
+	if err := dlq.Cancel(dlqConsumerTag, false); err != nil {
+		log.Printf("failed to cancel DLQ consumer: %v", err)
+	}
+	if err := ch.Cancel(workerConsumerTag, false); err != nil {
+		// без отмены канал доставок не закроется; неподтверждённые вернёт закрытие канала
+		log.Printf("failed to cancel consumer: %v", err)
+		return
+	}
+	for d := range msgs {
+		_ = d.Nack(false, true)
+	}
+}
+
+// Shutdown дожидается доставок, начатых до остановки, не дольше timeout. Оставшиеся
+// прерываются, их захват снимается, и сообщения возвращаются к доставке. Затем
+// закрываются канал и соединение. Вызывается после возврата из Start.
+func (c *MessageQueueConsumer) Shutdown(timeout time.Duration) {
+	drained := make(chan struct{})
+	go func() {
+		// ожидающие срока возвращают сообщения брокеру сразу после stopping
+		c.timers.Wait()
+		c.closePools()
+		c.recording.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+		log.Printf("drain timeout %s exceeded, interrupting remaining deliveries", timeout)
+		if c.abort != nil {
+			c.abort()
+		}
+		<-drained
+	}
+	c.Close()
+}
+
+// stopped сообщает, что воркер перестал принимать сообщения.
+func (c *MessageQueueConsumer) stopped() bool {
+	return isClosed(c.stopping)
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatch передаёт delivery пулу её канала. В режиме timer ненаступившее сообщение
+// сначала ждёт срока в отдельной горутине, не занимая обработчик пула.
+func (c *MessageQueueConsumer) dispatch(ctx context.Context, d amqp.Delivery, lost <-chan struct{}) {
+	if !c.delayBuckets {
+		var msg domain.Message
+		if err := json.Unmarshal(d.Body, &msg); err == nil && time.Until(msg.DueAt()) > 0 {
+			c.timers.Add(1)
+			go func() {
+				defer c.timers.Done()
+				if c.awaitDue(ctx, d, msg, lost) {
+					c.submit(ctx, d, lost)
+				}
+			}()
+			return
 		}
 	}
+	c.submit(ctx, d, lost)
 }
 
-func (c *MessageQueueConsumer) handleDelivery(ctx context.Context, d amqp.Delivery) {
+func (c *MessageQueueConsumer) submit(ctx context.Context, d amqp.Delivery, lost <-chan struct{}) {
+	if err := c.poolFor(d).Submit(ctx, func() { c.handleDelivery(ctx, d, lost) }); err != nil {
+		_ = d.Nack(false, true)
+	}
+}
+
+// poolFor выбирает пул по каналу сообщения; неразборчивое тело обработает общий пул.
+func (c *MessageQueueConsumer) poolFor(d amqp.Delivery) *pool.Pool {
+	var head struct {
+		Channel string `json:"channel"`
+	}
+	_ = json.Unmarshal(d.Body, &head)
+	if head.Channel == "" {
+		head.Channel = domain.DefaultChannel
+	}
+	if p, ok := c.lanes[head.Channel]; ok {
+		return p
+	}
+	return c.shared
+}
+
+// PoolStats возвращает загрузку пулов доставки: общего (shared) и пулов каналов.
+func (c *MessageQueueConsumer) PoolStats() map[string]pool.Stats {
+	stats := map[string]pool.Stats{"shared": c.shared.Stats()}
+	for channel, p := range c.lanes {
+		stats[channel] = p.Stats()
+	}
+	return stats
+}
+
+// handleDelivery обрабатывает одно сообщение. ctx отменяется, только когда Shutdown
+// прерывает недоставленное за время drain; lost закрывается при потере соединения,
+// по которому пришло сообщение (nil — не закрывается).
+func (c *MessageQueueConsumer) handleDelivery(ctx context.Context, d amqp.Delivery, lost <-chan struct{}) {
+	if c.stopped() {
+		// принято пулом, но не начато до остановки: пусть возьмёт другой воркер
+		_ = d.Nack(false, true)
+		return
+	}
+	if isClosed(lost) {
+		// брокер уже вернул сообщение в очередь и отдаст его по новому соединению
+		return
+	}
+
 	var msg domain.Message
 	if err := json.Unmarshal(d.Body, &msg); err != nil {
 		log.Printf("failed to unmarshal message: %v", err)
-		_ = d.Nack(false, false)
+		if err := c.deadLetter(ctx, d.Body, domain.DeadLetterUnparseable, err); err != nil {
+			// брокер сам переложит отклонённое сообщение в DLQ, но без текста ошибки
+			log.Printf("failed to move unparseable message to DLQ: %v", err)
+			_ = d.Nack(false, false)
+			return
+		}
+		_ = d.Ack(false)
 		return
 	}
+	if msg.Channel == "" {
+		// сообщения, опубликованные до появления каналов
+		msg.Channel = domain.DefaultChannel
+	}
 
-	delay := time.Until(msg.ScheduledAt)
-	if delay > 0 {
-		timer := time.NewTimer(delay)
-		defer timer.Stop()
-
-		select {
-		case <-ctx.Done():
-			_ = d.Nack(false, true)
+	if c.delayBuckets {
+		if bucket, ok := rabbitAdapter.DelayBucket(time.Until(msg.DueAt())); ok {
+			if status, err := c.repo.GetMessageStatus(ctx, msg.Id); err == nil && status == domain.JobStatusCancelled {
+				// отменённое сообщение не гоняем по бакетам до срока
+				log.Printf("message %s is cancelled, dropping", msg.Id)
+				_ = d.Ack(false)
+				return
+			}
+			c.deferDelivery(ctx, d, bucket)
 			return
-		case <-timer.C:
 		}
 	}
 
-	// Отправка сообщения с экспоненциальной политикой ретраев.
-	if err := c.sendWithRetry(ctx, &msg); err != nil {
-		log.Printf("failed to send message after retries: %v", err)
-		// помечаем как терминально упавшее
-		if err2 := c.repo.UpdateMessageStatus(ctx, msg.Id, domain.JobStatusTerminallyFailed); err2 != nil {
-			log.Printf("failed to mark message terminally failed: %v", err2)
-		}
-		if c.cache != nil {
-			_ = c.cache.SetStatus(ctx, msg.Id, domain.JobStatusTerminallyFailed, 5*time.Minute)
+	// в режиме db планировщик публикует только наступившие сообщения и ожидания нет;
+	// в режиме timer срока обычно дожидается dispatch, здесь — только повторно принятые
+	if !c.awaitDue(ctx, d, msg, lost) {
+		return
+	}
+
+	// Захват защищает от повторной доставки при повторном получении того же сообщения
+	// (requeue при остановке, at-least-once брокера, дубли из outbox).
+	attempt, err := c.repo.ClaimMessage(ctx, msg.Id, msg.Revision, c.lease)
+	if err != nil {
+		log.Printf("failed to claim message %s: %v", msg.Id, err)
+		_ = d.Nack(false, true)
+		return
+	}
+	if attempt == 0 {
+		// уже доставлено, отменено, изменено после публикации или доставляется другим
+		// воркером; брошенный захват вернёт к доставке ReleaseExpiredLeases
+		log.Printf("message %s is not claimable, skipping delivery", msg.Id)
+		c.skipCancelled(ctx, msg)
+		_ = d.Ack(false)
+		return
+	}
+
+	// Одна попытка отправки: повтор не ждёт в горутине, а сохраняется в БД (next_attempt_at)
+	// и переживает перезапуск воркера.
+	if err := c.send(ctx, &msg); err != nil {
+		if ctx.Err() != nil {
+			// отправку прервал Shutdown: захват снимается сразу, не дожидаясь его истечения
+			c.handBack(msg)
+			_ = d.Ack(false)
+			return
 		}
-		// сообщение обработано (больше не будет ретраев из очереди)
+		c.handleFailure(ctx, msg, attempt, err)
+		// дальнейшая судьба сообщения записана в БД, копия в очереди больше не нужна
 		_ = d.Ack(false)
 		return
 	}
 
-	// успешная отправка
-	if c.cache != nil {
+	// успешная отправка: статус Sent ставим только после подтверждения доставки;
+	// прерывание drain его уже не отменяет, иначе сообщение доставят повторно
+	ctx = context.WithoutCancel(ctx)
+	if err := c.repo.UpdateMessageStatus(ctx, msg.Id, domain.JobStatusSent); err != nil {
+		log.Printf("message %s delivered but status update failed: %v", msg.Id, err)
+	} else if c.cache != nil {
 		_ = c.cache.SetStatus(ctx, msg.Id, domain.JobStatusSent, 5*time.Minute)
 	}
+	c.scheduleNext(ctx, msg)
 
 	if err := d.Ack(false); err != nil {
 		log.Printf("failed to ack message: %v", err)
 	}
 }
 
-func (c *MessageQueueConsumer) Close() {
-	if c.ch != nil {
-		_ = c.ch.Close()
-	}
-	if c.conn != nil {
-		_ = c.conn.Close()
-	}
-}
-
-// sendWithRetry реализует экспоненциальную политику повторных попыток отправки.
-// Сейчас в качестве "отправки" используется обновление статуса в БД на Sent —
-// сюда же можно встроить реальный вызов внешнего сервиса (Telegram/email),
-// а UpdateMessageStatus вызывать после успешной доставки.
-func (c *MessageQueueConsumer) sendWithRetry(ctx context.Context, msg *domain.Message) error {
-	var lastErr error
-	attempts := len(retryDelays) + 1 // первая попытка без задержки + ретраи
-
-	for attempt := 0; attempt < attempts; attempt++ {
-		if attempt > 0 {
-			delay := retryDelays[attempt-1]
-			log.Printf("retry attempt %d for message %s after %s", attempt+1, msg.Id, delay)
-			timer := time.NewTimer(delay)
-			select {
-			case <-ctx.Done():
-				timer.Stop()
-				return ctx.Err()
-			case <-timer.C:
+// awaitDue держит сообщение неподтверждённым до срока (повтора). false — ждать
+// больше нечего: сообщение уже возвращено брокеру, подтверждено как отменённое или
+// его копию отдадут по новому соединению.
+func (c *MessageQueueConsumer) awaitDue(ctx context.Context, d amqp.Delivery, msg domain.Message, lost <-chan struct{}) bool {
+	delay := time.Until(msg.DueAt())
+	if delay <= 0 {
+		return true
+	}
+	waitCtx, done := c.wait(ctx, msg.Id)
+	defer done()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-c.stopping:
+		// срок не наступил, а захвата ещё нет: сообщение просто возвращается брокеру
+		_ = d.Nack(false, true)
+		return false
+	case <-lost:
+		// копия сообщения уже снова в очереди: ждать срока будет она
+		return false
+	case <-waitCtx.Done():
+		if ctx.Err() != nil {
+			_ = d.Nack(false, true)
+			return false
+		}
+		log.Printf("message %s cancelled while waiting, dropping", msg.Id)
+		c.scheduleNext(ctx, msg)
+		_ = d.Ack(false)
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// handleFailure назначает повтор по политике сообщения или, если повторять нельзя,
+// помечает сообщение терминально упавшим.
+func (c *MessageQueueConsumer) handleFailure(ctx context.Context, msg domain.Message, attempt int, sendErr error) {
+	if isTemporary(sendErr) {
+		policy := c.policies.For(msg)
+		if next, ok := policy.NextAttempt(attempt, msg.ScheduledAt, time.Now(), retryAfter(sendErr), rand.Float64()); ok {
+			if err := c.repo.ScheduleRetry(ctx, msg.Id, next); err != nil {
+				// сообщение осталось в Sending: его вернёт к доставке ReleaseExpiredLeases
+				log.Printf("failed to schedule retry of message %s: %v", msg.Id, err)
+				return
+			}
+			log.Printf("attempt %d to send message %s failed: %v; retry at %s", attempt, msg.Id, sendErr, next.Format(time.RFC3339))
+			if c.cache != nil {
+				_ = c.cache.SetStatus(ctx, msg.Id, domain.JobStatusFailed, 5*time.Minute)
 			}
+			return
 		}
+	}
 
-		// здесь должно быть реальное отправление во внешний сервис;
-		// сейчас считаем, что успешное обновление статуса = успех отправки.
-		if err := c.repo.UpdateMessageStatus(ctx, msg.Id, domain.JobStatusSent); err == nil {
-			return nil
-		} else {
-			lastErr = err
-			log.Printf("attempt %d to update status for %s failed: %v", attempt+1, msg.Id, err)
+	log.Printf("failed to send message %s after %d attempts: %v", msg.Id, attempt, sendErr)
+	if err := c.repo.UpdateMessageStatus(ctx, msg.Id, domain.JobStatusTerminallyFailed); err != nil {
+		log.Printf("failed to mark message terminally failed: %v", err)
+	} else {
+		if c.cache != nil {
+			_ = c.cache.SetStatus(ctx, msg.Id, domain.JobStatusTerminallyFailed, 5*time.Minute)
+		}
+		c.deadLetterMessage(ctx, msg, sendErr)
+	}
+	c.scheduleNext(ctx, msg)
+}
+
+// wait регистрирует ожидание срока сообщения id: отмена из рассылки прерывает
+// возвращённый контекст. done снимает регистрацию.
+func (c *MessageQueueConsumer) wait(ctx context.Context, id string) (context.Context, func()) {
+	waitCtx, cancel := context.WithCancel(ctx)
+	w := &waiter{cancel: cancel}
+	c.mu.Lock()
+	if c.waiting[id] == nil {
+		c.waiting[id] = make(map[*waiter]struct{})
+	}
+	c.waiting[id][w] = struct{}{}
+	c.mu.Unlock()
+	return waitCtx, func() {
+		c.mu.Lock()
+		// снимается только своя регистрация: другие доставки того же id ждут дальше
+		delete(c.waiting[id], w)
+		if len(c.waiting[id]) == 0 {
+			delete(c.waiting, id)
+		}
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// watchCancels прерывает ожидание отменённых сообщений, пока открыт канал ids.
+func (c *MessageQueueConsumer) watchCancels(ids <-chan string) {
+	for id := range ids {
+		c.mu.Lock()
+		for w := range c.waiting[id] {
+			w.cancel()
 		}
+		c.mu.Unlock()
+	}
+}
+
+// deferDelivery перекладывает ещё не наступившее сообщение в очередь ожидания bucket.
+// Ack только после подтверждения публикации: при ошибке сообщение вернётся в основную очередь.
+func (c *MessageQueueConsumer) deferDelivery(ctx context.Context, d amqp.Delivery, bucket time.Duration) {
+	err := c.publisher().Publish(ctx, workerExchangeName, rabbitAdapter.DelayQueueName(bucket), amqp.Publishing{
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		// приоритет нужен, когда бакет вернёт сообщение в notifications.queue
+		Priority: d.Priority,
+		Headers:  d.Headers,
+		Body:     d.Body,
+	})
+	if err != nil {
+		log.Printf("failed to move message to delay queue %s: %v", rabbitAdapter.DelayQueueName(bucket), err)
+		_ = d.Nack(false, true)
+		return
+	}
+	_ = d.Ack(false)
+}
+
+// declareDelayQueues объявляет очереди ожидания с теми же аргументами, что и продьюсер.
+func declareDelayQueues(ch *amqp.Channel) error {
+	for _, bucket := range rabbitAdapter.DelayBuckets {
+		name := rabbitAdapter.DelayQueueName(bucket)
+		if _, err := ch.QueueDeclare(name, true, false, false, false, rabbitAdapter.DelayQueueArgs(bucket)); err != nil {
+			return err
+		}
+		if err := ch.QueueBind(name, name, workerExchangeName, false, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduleNext планирует следующее вхождение, если msg — часть повторяющейся серии.
+func (c *MessageQueueConsumer) scheduleNext(ctx context.Context, msg domain.Message) {
+	if c.recurrence == nil || msg.ParentId == "" {
+		return
+	}
+	if err := c.recurrence.ScheduleNext(ctx, msg); err != nil {
+		log.Printf("failed to schedule next occurrence after %s: %v", msg.Id, err)
+	}
+}
+
+// skipCancelled продолжает серию, если незахваченное вхождение отменено. Обычно
+// следующее уже запланировал API при отмене, и повтор упрётся в id вхождения.
+func (c *MessageQueueConsumer) skipCancelled(ctx context.Context, msg domain.Message) {
+	if c.recurrence == nil || msg.ParentId == "" {
+		return
 	}
+	if status, err := c.repo.GetMessageStatus(ctx, msg.Id); err == nil && status == domain.JobStatusCancelled {
+		c.scheduleNext(ctx, msg)
+	}
+}
 
-	return lastErr
+// handBack снимает захват с сообщения, отправку которого прервала остановка:
+// его снова опубликует планировщик (или relay outbox), и доставку продолжит другой воркер.
+func (c *MessageQueueConsumer) handBack(msg domain.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.repo.ReleaseLease(ctx, msg.Id); err != nil {
+		// сообщение останется в Sending до истечения захвата
+		log.Printf("failed to release lease of message %s: %v", msg.Id, err)
+		return
+	}
+	log.Printf("delivery of message %s interrupted by shutdown, handed back", msg.Id)
 }
 
+// closePools дожидается задач, уже принятых пулами.
+func (c *MessageQueueConsumer) closePools() {
+	if c.shared != nil {
+		c.shared.Close()
+	}
+	for _, p := range c.lanes {
+		p.Close()
+	}
+}
 
+func (c *MessageQueueConsumer) Close() {
+	// принятые задачи завершаются до закрытия канала, иначе их Ack потеряется
+	c.closePools()
+	c.closeConnection()
+	c.connected.Store(false)
+}
+
+// send делает одну попытку доставки через notifier канала и пишет её в историю.
+func (c *MessageQueueConsumer) send(ctx context.Context, msg *domain.Message) error {
+	started := time.Now()
+	n, err := c.notifiers.Get(msg.Channel)
+	if err == nil {
+		err = n.Send(ctx, *msg)
+	}
+	// ненастроенный канал (например, SMTP) — тоже ответ на «почему не пришло»
+	c.recordAttempt(ctx, msg, started, err)
+	return err
+}
+
+// isTemporary считает временными все ошибки, кроме тех, что явно
+// помечены отправителем как постоянные (Temporary() == false).
+func isTemporary(err error) bool {
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+	return true
+}
+
+// retryAfter возвращает задержку, которую запросил внешний сервис, если она есть.
+func retryAfter(err error) time.Duration {
+	var r interface{ RetryAfter() time.Duration }
+	if errors.As(err, &r) {
+		return r.RetryAfter()
+	}
+	return 0
+}
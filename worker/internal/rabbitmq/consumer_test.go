@@ -0,0 +1,819 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	rabbitAdapter "github.com/dontpanicw/DelayedNotifier/internal/adapter/rabbitmq"
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/notifier"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/notifier/telegram"
+	"github.com/dontpanicw/DelayedNotifier/worker/internal/pool"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// claimRepo пропускает захват только для ещё не захваченных сообщений актуальной ревизии.
+type claimRepo struct {
+	port.Repository
+	mu       sync.Mutex
+	claimed  map[string]bool
+	status   map[string]string
+	revision map[string]int
+	attempts []domain.DeliveryAttempt
+
+	attempt  int
+	retryAt  time.Time
+	released []string
+}
+
+func (r *claimRepo) RecordAttempt(ctx context.Context, attempt domain.DeliveryAttempt) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, attempt)
+	return len(r.attempts), nil
+}
+
+func (r *claimRepo) ClaimMessage(ctx context.Context, id string, revision int, lease time.Duration) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.claimed[id] || r.revision[id] != revision || r.status[id] == domain.JobStatusCancelled {
+		return 0, nil
+	}
+	r.claimed[id] = true
+	r.attempt++
+	return r.attempt, nil
+}
+
+// ScheduleRetry возвращает сообщение к захвату, как это сделает повторная публикация.
+func (r *claimRepo) ScheduleRetry(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.claimed[id] = false
+	r.status[id] = domain.JobStatusFailed
+	r.retryAt = at
+	return nil
+}
+
+func (r *claimRepo) UpdateMessageStatus(ctx context.Context, id, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status[id] = status
+	return nil
+}
+
+// ReleaseLease снимает захват, как это сделает репозиторий при прерванной отправке.
+func (r *claimRepo) ReleaseLease(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.claimed[id] = false
+	r.status[id] = domain.JobStatusScheduled
+	r.released = append(r.released, id)
+	return nil
+}
+
+func (r *claimRepo) GetMessageStatus(ctx context.Context, id string) (string, error) {
+	return r.statusOf(id), nil
+}
+
+func (r *claimRepo) statusOf(id string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status[id]
+}
+
+// seriesRecorder запоминает вхождения, после которых планировалось следующее.
+type seriesRecorder struct {
+	next []string
+}
+
+func (r *seriesRecorder) ScheduleNext(ctx context.Context, occurrence domain.Message) error {
+	r.next = append(r.next, occurrence.Id)
+	return nil
+}
+
+type countingNotifier struct {
+	sent int
+}
+
+func (n *countingNotifier) Channel() string { return domain.ChannelTelegram }
+
+func (n *countingNotifier) Send(ctx context.Context, message domain.Message) error {
+	n.sent++
+	return nil
+}
+
+// ackRecorder запоминает, чем завершилась обработка delivery.
+type ackRecorder struct {
+	mu                      sync.Mutex
+	acked, nacked, requeued int
+}
+
+func (a *ackRecorder) Ack(tag uint64, multiple bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked++
+	return nil
+}
+
+func (a *ackRecorder) Nack(tag uint64, multiple, requeue bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nacked++
+	if requeue {
+		a.requeued++
+	}
+	return nil
+}
+
+// result возвращает снимок счётчиков.
+func (a *ackRecorder) result() (acked, nacked, requeued int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.acked, a.nacked, a.requeued
+}
+
+func (a *ackRecorder) Reject(tag uint64, requeue bool) error {
+	a.nacked++
+	return nil
+}
+
+// fakeChannel — канал брокера в памяти: отдаёт доставки из deliveries
+// и, как RabbitMQ, закрывает их после Cancel.
+type fakeChannel struct {
+	mu         sync.Mutex
+	deliveries chan amqp.Delivery
+	prefetch   int
+	cancelled  bool
+	closed     bool
+	// closeDeliveries: канал доставок закрывают Cancel, Close и разрыв соединения
+	closeDeliveries sync.Once
+}
+
+func newFakeChannel() *fakeChannel {
+	return &fakeChannel{deliveries: make(chan amqp.Delivery, 16)}
+}
+
+func (f *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prefetch = prefetchCount
+	return nil
+}
+
+func (f *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return f.deliveries, nil
+}
+
+func (f *fakeChannel) Cancel(consumer string, noWait bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closeDeliveries.Do(func() { close(f.deliveries) })
+	f.cancelled = true
+	return nil
+}
+
+// drop закрывает канал доставок, как это делает amqp091 при разрыве соединения.
+func (f *fakeChannel) drop() {
+	f.closeDeliveries.Do(func() { close(f.deliveries) })
+}
+
+func (f *fakeChannel) qos() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.prefetch
+}
+
+func (f *fakeChannel) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closeDeliveries.Do(func() { close(f.deliveries) })
+	f.closed = true
+	return nil
+}
+
+// fakePublisher запоминает публикации; err — ответ брокера (nack, return).
+type fakePublisher struct {
+	mu          sync.Mutex
+	err         error
+	keys        []string
+	publishings []amqp.Publishing
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.keys = append(p.keys, key)
+	p.publishings = append(p.publishings, msg)
+	return nil
+}
+
+func (p *fakePublisher) Close() error { return nil }
+
+func delivery(t *testing.T, msg domain.Message, ack amqp.Acknowledger) amqp.Delivery {
+	t.Helper()
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return amqp.Delivery{Acknowledger: ack, Body: body}
+}
+
+func TestHandleDelivery_DeliversOnlyOnce(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &countingNotifier{}
+	c := &MessageQueueConsumer{repo: repo, notifiers: notifier.NewRegistry(n), lease: time.Minute}
+
+	msg := domain.Message{Id: "m1", Channel: domain.ChannelTelegram, ScheduledAt: time.Now()}
+	first, second := &ackRecorder{}, &ackRecorder{}
+	c.handleDelivery(context.Background(), delivery(t, msg, first), nil)
+	// тот же Message.Id пришёл повторно (requeue или дубль публикации)
+	c.handleDelivery(context.Background(), delivery(t, msg, second), nil)
+
+	if n.sent != 1 {
+		t.Fatalf("expected a single delivery, got %d", n.sent)
+	}
+	if repo.status["m1"] != domain.JobStatusSent {
+		t.Fatalf("expected status Sent, got %q", repo.status["m1"])
+	}
+	if first.acked != 1 || second.acked != 1 || second.nacked != 0 {
+		t.Fatalf("expected both deliveries to be acked, got %+v %+v", first, second)
+	}
+}
+
+func TestHandleDelivery_CancelledWhileWaiting(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &countingNotifier{}
+	series := &seriesRecorder{}
+	c := &MessageQueueConsumer{repo: repo, notifiers: notifier.NewRegistry(n), recurrence: series, lease: time.Minute, waiting: map[string]map[*waiter]struct{}{}}
+
+	ids := make(chan string)
+	go c.watchCancels(ids)
+	defer close(ids)
+
+	msg := domain.Message{Id: "m1", ParentId: "series", Channel: domain.ChannelTelegram, ScheduledAt: time.Now().Add(time.Hour)}
+	ack := &ackRecorder{}
+	done := make(chan struct{})
+	go func() {
+		c.handleDelivery(context.Background(), delivery(t, msg, ack), nil)
+		close(done)
+	}()
+
+	// ждём, пока воркер начнёт ожидать срок
+	for deadline := time.Now().Add(time.Second); ; {
+		c.mu.Lock()
+		_, waiting := c.waiting["m1"]
+		c.mu.Unlock()
+		if waiting {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery did not start waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ids <- "m1"
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("cancellation did not interrupt waiting")
+	}
+	if n.sent != 0 || repo.claimed["m1"] {
+		t.Fatalf("cancelled message must not be claimed or sent")
+	}
+	if ack.acked != 1 || ack.nacked != 0 {
+		t.Fatalf("expected cancelled delivery to be acked, got %+v", ack)
+	}
+	if len(series.next) != 1 {
+		t.Fatalf("expected series to continue after cancelled occurrence, got %v", series.next)
+	}
+}
+
+func TestWait_SameIDTwice(t *testing.T) {
+	c := &MessageQueueConsumer{waiting: map[string]map[*waiter]struct{}{}}
+	ids := make(chan string)
+	go c.watchCancels(ids)
+	defer close(ids)
+
+	first, doneFirst := c.wait(context.Background(), "m1")
+	second, doneSecond := c.wait(context.Background(), "m1")
+
+	// завершение одной доставки не снимает ожидание другой
+	doneFirst()
+	if first.Err() == nil {
+		t.Fatalf("expected done to cancel its own wait")
+	}
+	ids <- "m1"
+	select {
+	case <-second.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("cancellation did not interrupt the second wait on the same id")
+	}
+
+	doneSecond()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.waiting) != 0 {
+		t.Fatalf("expected no registrations left, got %v", c.waiting)
+	}
+}
+
+func TestHandleDelivery_CancelledOccurrenceContinuesSeries(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{"m1": domain.JobStatusCancelled}}
+	n := &countingNotifier{}
+	series := &seriesRecorder{}
+	c := &MessageQueueConsumer{repo: repo, notifiers: notifier.NewRegistry(n), recurrence: series, lease: time.Minute}
+
+	ack := &ackRecorder{}
+	msg := domain.Message{Id: "m1", ParentId: "series", Channel: domain.ChannelTelegram, ScheduledAt: time.Now()}
+	c.handleDelivery(context.Background(), delivery(t, msg, ack), nil)
+	if n.sent != 0 || ack.acked != 1 {
+		t.Fatalf("expected cancelled occurrence to be acked without delivery, got sent=%d %+v", n.sent, ack)
+	}
+	if len(series.next) != 1 || series.next[0] != "m1" {
+		t.Fatalf("expected series to continue after cancelled occurrence, got %v", series.next)
+	}
+
+	// устаревшая копия живого вхождения серию не двигает
+	repo.status["m1"] = domain.JobStatusScheduled
+	repo.revision = map[string]int{"m1": 1}
+	c.handleDelivery(context.Background(), delivery(t, msg, &ackRecorder{}), nil)
+	if len(series.next) != 1 {
+		t.Fatalf("expected only cancelled occurrences to continue the series, got %v", series.next)
+	}
+}
+
+func TestHandleDelivery_StaleRevisionIsDropped(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}, revision: map[string]int{"m1": 1}}
+	n := &countingNotifier{}
+	c := &MessageQueueConsumer{repo: repo, notifiers: notifier.NewRegistry(n), lease: time.Minute}
+
+	// копия опубликована до изменения сообщения через PATCH
+	stale := domain.Message{Id: "m1", Channel: domain.ChannelTelegram, ScheduledAt: time.Now()}
+	ack := &ackRecorder{}
+	c.handleDelivery(context.Background(), delivery(t, stale, ack), nil)
+	if n.sent != 0 || ack.acked != 1 {
+		t.Fatalf("expected stale copy to be acked without delivery, got sent=%d %+v", n.sent, ack)
+	}
+
+	fresh := stale
+	fresh.Revision = 1
+	c.handleDelivery(context.Background(), delivery(t, fresh, &ackRecorder{}), nil)
+	if n.sent != 1 {
+		t.Fatalf("expected current revision to be delivered, got %d", n.sent)
+	}
+}
+
+func TestHandleDelivery_SchedulesRetryByPolicy(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &failingNotifier{err: &telegram.Error{Code: 502, Description: "Bad Gateway"}}
+	policies := domain.DefaultRetryPolicies()
+	policies.Policies["twice"] = domain.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Minute, Multiplier: 2}
+	c := &MessageQueueConsumer{repo: repo, pub: &fakePublisher{}, notifiers: notifier.NewRegistry(n), lease: time.Minute, policies: policies}
+
+	msg := domain.Message{Id: "m1", Channel: domain.ChannelTelegram, ScheduledAt: time.Now(), RetryPolicy: "twice"}
+	first := &ackRecorder{}
+	before := time.Now()
+	c.handleDelivery(context.Background(), delivery(t, msg, first), nil)
+
+	// временная ошибка: повтор сохранён в БД, а не ждёт в горутине
+	if repo.status["m1"] != domain.JobStatusFailed || first.acked != 1 {
+		t.Fatalf("expected retry to be scheduled and delivery acked, got %q %+v", repo.status["m1"], first)
+	}
+	if repo.retryAt.Before(before.Add(time.Minute)) {
+		t.Fatalf("expected retry after base delay, got %s", repo.retryAt)
+	}
+
+	// срок повтора наступил: вторая попытка исчерпывает политику
+	past := time.Now().Add(-time.Second)
+	msg.NextAttemptAt = &past
+	c.handleDelivery(context.Background(), delivery(t, msg, &ackRecorder{}), nil)
+	if repo.status["m1"] != domain.JobStatusTerminallyFailed || len(repo.attempts) != 2 {
+		t.Fatalf("expected terminal failure after 2 attempts, got %q after %d", repo.status["m1"], len(repo.attempts))
+	}
+}
+
+type failingNotifier struct {
+	err error
+}
+
+func (n *failingNotifier) Channel() string { return domain.ChannelTelegram }
+
+func (n *failingNotifier) Send(ctx context.Context, message domain.Message) error {
+	return n.err
+}
+
+func TestHandleDelivery_RecordsAttempts(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &failingNotifier{err: &telegram.Error{Code: 403, Description: "Forbidden: bot was blocked by the user"}}
+	pub := &fakePublisher{}
+	c := &MessageQueueConsumer{repo: repo, pub: pub, notifiers: notifier.NewRegistry(n), lease: time.Minute, policies: domain.DefaultRetryPolicies()}
+
+	msg := domain.Message{Id: "m1", Channel: domain.ChannelTelegram, ScheduledAt: time.Now()}
+	c.handleDelivery(context.Background(), delivery(t, msg, &ackRecorder{}), nil)
+
+	// постоянная ошибка не ретраится: ровно одна попытка
+	if len(repo.attempts) != 1 {
+		t.Fatalf("expected one recorded attempt, got %d", len(repo.attempts))
+	}
+	a := repo.attempts[0]
+	if a.Outcome != domain.AttemptFailed || a.ErrorClass != domain.ErrorClassPermanent ||
+		a.ResponseCode != 403 || a.ResponseBody != "Forbidden: bot was blocked by the user" {
+		t.Fatalf("unexpected attempt %+v", a)
+	}
+	if a.FinishedAt.Before(a.StartedAt) {
+		t.Fatalf("finished_at must not precede started_at")
+	}
+	if repo.status["m1"] != domain.JobStatusTerminallyFailed {
+		t.Fatalf("expected status Terminally_Failed, got %q", repo.status["m1"])
+	}
+
+	// терминально упавшее сообщение уходит в DLQ с причиной и ошибкой
+	if len(pub.keys) != 1 || pub.keys[0] != rabbitAdapter.DeadLetterQueueName {
+		t.Fatalf("expected message in DLQ, got %v", pub.keys)
+	}
+	h := pub.publishings[0].Headers
+	if h[rabbitAdapter.DeadLetterReasonHeader] != domain.DeadLetterTerminallyFailed || h[rabbitAdapter.DeadLetterErrorHeader] == "" {
+		t.Fatalf("unexpected DLQ headers %v", h)
+	}
+}
+
+func TestHandleDelivery_UnparseableGoesToDLQ(t *testing.T) {
+	pub := &fakePublisher{}
+	c := &MessageQueueConsumer{pub: pub}
+
+	ack := &ackRecorder{}
+	c.handleDelivery(context.Background(), amqp.Delivery{Acknowledger: ack, Body: []byte("{broken")}, nil)
+
+	if ack.acked != 1 || len(pub.keys) != 1 || pub.keys[0] != rabbitAdapter.DeadLetterQueueName {
+		t.Fatalf("expected unparseable body to be moved to DLQ and acked, got %v %+v", pub.keys, ack)
+	}
+	if pub.publishings[0].Headers[rabbitAdapter.DeadLetterReasonHeader] != domain.DeadLetterUnparseable {
+		t.Fatalf("unexpected DLQ headers %v", pub.publishings[0].Headers)
+	}
+}
+
+func TestHandleDelivery_UnconfirmedDLQPublish(t *testing.T) {
+	c := &MessageQueueConsumer{pub: &fakePublisher{err: rabbitAdapter.ErrPublishUnroutable}}
+
+	// без подтверждения DLQ доставка не подтверждается: её переложит брокер
+	ack := &ackRecorder{}
+	c.handleDelivery(context.Background(), amqp.Delivery{Acknowledger: ack, Body: []byte("{broken")}, nil)
+	if acked, nacked, requeued := ack.result(); acked != 0 || nacked != 1 || requeued != 0 {
+		t.Fatalf("expected delivery to be rejected without requeue, got %+v", ack)
+	}
+}
+
+func TestDeferDelivery_WaitsForConfirm(t *testing.T) {
+	pub := &fakePublisher{}
+	c := &MessageQueueConsumer{pub: pub}
+
+	ack := &ackRecorder{}
+	c.deferDelivery(context.Background(), amqp.Delivery{Acknowledger: ack, Body: []byte(`{"id":"m1"}`)}, time.Minute)
+	if acked, _, _ := ack.result(); acked != 1 || len(pub.keys) != 1 || pub.keys[0] != rabbitAdapter.DelayQueueName(time.Minute) {
+		t.Fatalf("expected confirmed move to the delay queue to be acked, got %v %+v", pub.keys, ack)
+	}
+
+	// брокер не принял копию: исходная доставка возвращается в очередь
+	pub.err = rabbitAdapter.ErrPublishNacked
+	ack = &ackRecorder{}
+	c.deferDelivery(context.Background(), amqp.Delivery{Acknowledger: ack, Body: []byte(`{"id":"m1"}`)}, time.Minute)
+	if acked, nacked, requeued := ack.result(); acked != 0 || nacked != 1 || requeued != 1 {
+		t.Fatalf("expected unconfirmed delivery to be requeued, got %+v", ack)
+	}
+}
+
+// deadLetterRepo запоминает сохранённые записи DLQ.
+type deadLetterRepo struct {
+	port.Repository
+	letters []domain.DeadLetter
+}
+
+func (r *deadLetterRepo) RecordDeadLetter(ctx context.Context, letter domain.DeadLetter) error {
+	r.letters = append(r.letters, letter)
+	return nil
+}
+
+func TestRecordDeadLetter_Reason(t *testing.T) {
+	repo := &deadLetterRepo{}
+	c := &MessageQueueConsumer{repo: repo}
+
+	// истёкшее в notifications.queue сообщение брокер перекладывает сам
+	expired := delivery(t, domain.Message{Id: "m1"}, &ackRecorder{})
+	expired.Headers = amqp.Table{"x-first-death-reason": "expired"}
+	c.recordDeadLetter(context.Background(), expired)
+
+	ack := &ackRecorder{}
+	c.recordDeadLetter(context.Background(), amqp.Delivery{Acknowledger: ack, Body: []byte("\xff{broken"), Headers: amqp.Table{
+		rabbitAdapter.DeadLetterReasonHeader: domain.DeadLetterUnparseable,
+		rabbitAdapter.DeadLetterErrorHeader:  "invalid character",
+	}})
+
+	if len(repo.letters) != 2 || ack.acked != 1 {
+		t.Fatalf("expected both dead letters to be recorded and acked, got %d", len(repo.letters))
+	}
+	if l := repo.letters[0]; l.MessageId != "m1" || l.Reason != domain.DeadLetterExpired {
+		t.Fatalf("unexpected expired letter %+v", l)
+	}
+	if l := repo.letters[1]; l.MessageId != "" || l.Reason != domain.DeadLetterUnparseable || l.Error != "invalid character" || !utf8.ValidString(l.Payload) {
+		t.Fatalf("unexpected unparseable letter %+v", l)
+	}
+}
+
+func TestDispatch_UsesChannelPool(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &countingNotifier{}
+	c := &MessageQueueConsumer{
+		repo:      repo,
+		notifiers: notifier.NewRegistry(n),
+		lease:     time.Minute,
+		shared:    pool.New(2, 4),
+		lanes:     map[string]*pool.Pool{domain.ChannelEmail: pool.New(1, 4)},
+	}
+
+	email := delivery(t, domain.Message{Id: "e1", Channel: domain.ChannelEmail}, &ackRecorder{})
+	if c.poolFor(email) != c.lanes[domain.ChannelEmail] {
+		t.Fatalf("expected email delivery to use the email pool")
+	}
+	// сообщения без канала — telegram, своего пула у него нет
+	if c.poolFor(delivery(t, domain.Message{Id: "t1"}, &ackRecorder{})) != c.shared {
+		t.Fatalf("expected telegram delivery to use the shared pool")
+	}
+
+	ack := &ackRecorder{}
+	c.dispatch(context.Background(), delivery(t, domain.Message{Id: "t1", ScheduledAt: time.Now()}, ack), nil)
+	c.Close()
+	if n.sent != 1 || ack.acked != 1 {
+		t.Fatalf("expected delivery to be handled by the pool before Close returns, got sent=%d %+v", n.sent, ack)
+	}
+	if s := c.PoolStats(); s["shared"].Workers != 2 || s[domain.ChannelEmail].Workers != 1 || s["shared"].InFlight != 0 {
+		t.Fatalf("unexpected pool stats %+v", s)
+	}
+}
+
+// blockingNotifier не завершает отправку, пока её не отпустят или не прервут.
+type blockingNotifier struct {
+	started chan string
+	release chan struct{}
+}
+
+func (n *blockingNotifier) Channel() string { return domain.ChannelTelegram }
+
+func (n *blockingNotifier) Send(ctx context.Context, message domain.Message) error {
+	n.started <- message.Id
+	select {
+	case <-n.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startConsumer запускает consumer поверх fakeChannel; Start возвращает ошибку в канал.
+func startConsumer(ctx context.Context, repo port.Repository, n port.Notifier) (*MessageQueueConsumer, *fakeChannel, chan error) {
+	ch := newFakeChannel()
+	c := &MessageQueueConsumer{
+		ch:        ch,
+		dlq:       newFakeChannel(),
+		pub:       &fakePublisher{},
+		repo:      repo,
+		notifiers: notifier.NewRegistry(n),
+		lease:     time.Minute,
+		policies:  domain.DefaultRetryPolicies(),
+		prefetch:  4,
+		shared:    pool.New(2, 4),
+		stopping:  make(chan struct{}),
+		waiting:   map[string]map[*waiter]struct{}{},
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- c.Start(ctx) }()
+	return c, ch, errs
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShutdown_DrainsInFlightAndHandsBackWaiting(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &blockingNotifier{started: make(chan string, 4), release: make(chan struct{})}
+	ctx, stop := context.WithCancel(context.Background())
+	c, ch, errs := startConsumer(ctx, repo, n)
+
+	sending, waiting := &ackRecorder{}, &ackRecorder{}
+	ch.deliveries <- delivery(t, domain.Message{Id: "now", ScheduledAt: time.Now()}, sending)
+	<-n.started
+	ch.deliveries <- delivery(t, domain.Message{Id: "later", ScheduledAt: time.Now().Add(time.Hour)}, waiting)
+	eventually(t, "message to wait for its time", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.waiting["later"] != nil
+	})
+
+	stop() // SIGTERM
+	if err := <-errs; err != nil {
+		t.Fatalf("expected clean stop, got %v", err)
+	}
+	if !ch.cancelled || ch.prefetch != 4 {
+		t.Fatalf("expected consumer to be cancelled with prefetch 4, got cancelled=%v prefetch=%d", ch.cancelled, ch.prefetch)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Shutdown(time.Second)
+		close(done)
+	}()
+
+	// не наступившее сообщение возвращается брокеру сразу, не дожидаясь drain
+	eventually(t, "waiting message to be requeued", func() bool {
+		_, _, requeued := waiting.result()
+		return requeued == 1
+	})
+	select {
+	case <-done:
+		t.Fatalf("Shutdown returned before the in-flight delivery finished")
+	default:
+	}
+
+	close(n.release)
+	<-done
+	if acked, _, _ := sending.result(); acked != 1 || repo.statusOf("now") != domain.JobStatusSent {
+		t.Fatalf("expected in-flight delivery to complete and be acked, got acked=%d status=%q", acked, repo.statusOf("now"))
+	}
+	if !ch.closed {
+		t.Fatalf("expected channel to be closed after drain")
+	}
+}
+
+func TestDispatch_WaitingDoesNotHoldWorkers(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &blockingNotifier{started: make(chan string, 1), release: make(chan struct{})}
+	ctx, stop := context.WithCancel(context.Background())
+	c, ch, errs := startConsumer(ctx, repo, n)
+
+	// ненаступивших сообщений столько же, сколько обработчиков общего пула
+	later := []*ackRecorder{{}, {}}
+	for i, ack := range later {
+		ch.deliveries <- delivery(t, domain.Message{Id: fmt.Sprintf("later%d", i), ScheduledAt: time.Now().Add(time.Hour)}, ack)
+	}
+	eventually(t, "messages to wait for their time", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.waiting) == 2
+	})
+	if s := c.PoolStats()["shared"]; s.InFlight != 0 || s.Queued != 0 {
+		t.Fatalf("waiting messages must not occupy the pool, got %+v", s)
+	}
+
+	ch.deliveries <- delivery(t, domain.Message{Id: "now", ScheduledAt: time.Now()}, &ackRecorder{})
+	select {
+	case id := <-n.started:
+		if id != "now" {
+			t.Fatalf("expected due message to be sent, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("due message is stuck behind waiting ones")
+	}
+
+	close(n.release)
+	stop()
+	if err := <-errs; err != nil {
+		t.Fatalf("expected clean stop, got %v", err)
+	}
+	c.Shutdown(time.Second)
+	for i, ack := range later {
+		if _, _, requeued := ack.result(); requeued != 1 {
+			t.Fatalf("expected waiting message %d to be requeued on shutdown", i)
+		}
+	}
+}
+
+func TestShutdown_TimeoutHandsBackLease(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &blockingNotifier{started: make(chan string, 1), release: make(chan struct{})}
+	ctx, stop := context.WithCancel(context.Background())
+	c, ch, errs := startConsumer(ctx, repo, n)
+
+	stuck := &ackRecorder{}
+	ch.deliveries <- delivery(t, domain.Message{Id: "stuck", ScheduledAt: time.Now()}, stuck)
+	<-n.started
+
+	stop()
+	<-errs
+	c.Shutdown(20 * time.Millisecond)
+
+	// отправка не успела за drain: её прервали, а захват сняли, не дожидаясь истечения
+	if len(repo.released) != 1 || repo.statusOf("stuck") != domain.JobStatusScheduled {
+		t.Fatalf("expected lease to be handed back, got released=%v status=%q", repo.released, repo.statusOf("stuck"))
+	}
+	if acked, _, _ := stuck.result(); acked != 1 {
+		t.Fatalf("expected interrupted delivery to be acked, got %d", acked)
+	}
+	if a := repo.attempts; len(a) != 1 || a[0].ErrorClass != domain.ErrorClassCancelled {
+		t.Fatalf("expected a cancelled attempt to be recorded, got %+v", a)
+	}
+	if !ch.closed {
+		t.Fatalf("expected channel to be closed")
+	}
+}
+
+func TestStart_ReconnectsAfterConnectionLoss(t *testing.T) {
+	repo := &claimRepo{claimed: map[string]bool{}, status: map[string]string{}}
+	n := &blockingNotifier{started: make(chan string, 4), release: make(chan struct{})}
+	close(n.release)
+
+	first, second := newFakeChannel(), newFakeChannel()
+	restore := make(chan struct{})
+	var dials int
+	c := &MessageQueueConsumer{
+		ch:  first,
+		dlq: newFakeChannel(),
+		pub: &fakePublisher{},
+		dial: func() (io.Closer, amqpChannel, amqpChannel, publisher, error) {
+			// первая попытка не удаётся, вторая ждёт, пока брокер «вернётся»
+			if dials++; dials == 1 {
+				return nil, nil, nil, nil, errors.New("connection refused")
+			}
+			<-restore
+			return io.NopCloser(nil), second, newFakeChannel(), &fakePublisher{}, nil
+		},
+		reconnectDelay: time.Millisecond,
+		repo:           repo,
+		notifiers:      notifier.NewRegistry(n),
+		lease:          time.Minute,
+		policies:       domain.DefaultRetryPolicies(),
+		prefetch:       4,
+		shared:         pool.New(2, 4),
+		stopping:       make(chan struct{}),
+		waiting:        map[string]map[*waiter]struct{}{},
+	}
+	c.connected.Store(true)
+	ctx, stop := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- c.Start(ctx) }()
+
+	msg := domain.Message{Id: "m1", Channel: domain.ChannelTelegram, ScheduledAt: time.Now().Add(200 * time.Millisecond)}
+	lost := &ackRecorder{}
+	first.deliveries <- delivery(t, msg, lost)
+	eventually(t, "message to wait for its time", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.waiting["m1"] != nil
+	})
+
+	first.drop()
+	eventually(t, "waiting delivery of the lost connection to give up", func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.waiting["m1"] == nil
+	})
+	if c.Connected() {
+		t.Fatalf("expected consumer to report lost connection")
+	}
+	// канал закрыт вместе с соединением: брокер сам вернул сообщение в очередь
+	if acked, nacked, _ := lost.result(); acked != 0 || nacked != 0 {
+		t.Fatalf("expected no ack on the lost channel, got acked=%d nacked=%d", acked, nacked)
+	}
+
+	close(restore)
+	eventually(t, "consumer to reconnect", c.Connected)
+	redelivered := &ackRecorder{}
+	second.deliveries <- delivery(t, msg, redelivered)
+	eventually(t, "redelivered message to be sent", func() bool {
+		acked, _, _ := redelivered.result()
+		return acked == 1
+	})
+	if len(n.started) != 1 || repo.statusOf("m1") != domain.JobStatusSent {
+		t.Fatalf("expected a single delivery, got %d sends and status %q", len(n.started), repo.statusOf("m1"))
+	}
+	if second.qos() != 4 {
+		t.Fatalf("expected prefetch to be applied on the new channel, got %d", second.qos())
+	}
+
+	stop()
+	if err := <-errs; err != nil {
+		t.Fatalf("expected clean stop, got %v", err)
+	}
+	c.Shutdown(time.Second)
+	if !first.closed || !second.closed {
+		t.Fatalf("expected both channels to be closed")
+	}
+}
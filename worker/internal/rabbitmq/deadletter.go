@@ -0,0 +1,82 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	rabbitAdapter "github.com/dontpanicw/DelayedNotifier/internal/adapter/rabbitmq"
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// deadLetter кладёт тело сообщения в DLQ с причиной и текстом ошибки и ждёт
+// подтверждения брокера: только после него исходную доставку можно подтвердить.
+func (c *MessageQueueConsumer) deadLetter(ctx context.Context, body []byte, reason string, cause error) error {
+	headers := amqp.Table{rabbitAdapter.DeadLetterReasonHeader: reason}
+	if cause != nil {
+		headers[rabbitAdapter.DeadLetterErrorHeader] = cause.Error()
+	}
+	return c.publisher().Publish(ctx, "", rabbitAdapter.DeadLetterQueueName, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Headers:      headers,
+		Body:         body,
+	})
+}
+
+// deadLetterMessage кладёт в DLQ терминально упавшее сообщение. Статус уже записан,
+// поэтому сбой публикации только теряет запись DLQ, а не само сообщение.
+func (c *MessageQueueConsumer) deadLetterMessage(ctx context.Context, msg domain.Message, cause error) {
+	body, err := json.Marshal(msg)
+	if err == nil {
+		err = c.deadLetter(ctx, body, domain.DeadLetterTerminallyFailed, cause)
+	}
+	if err != nil {
+		log.Printf("failed to move message %s to DLQ: %v", msg.Id, err)
+	}
+}
+
+// recordDeadLetters сохраняет сообщения из DLQ в БД, пока открыт канал deliveries.
+func (c *MessageQueueConsumer) recordDeadLetters(ctx context.Context, deliveries <-chan amqp.Delivery) {
+	for d := range deliveries {
+		c.recordDeadLetter(ctx, d)
+	}
+}
+
+func (c *MessageQueueConsumer) recordDeadLetter(ctx context.Context, d amqp.Delivery) {
+	letter := deadLetterFrom(d)
+	if err := c.repo.RecordDeadLetter(ctx, letter); err != nil {
+		log.Printf("failed to record dead letter of message %q: %v", letter.MessageId, err)
+		_ = d.Nack(false, true)
+		return
+	}
+	log.Printf("dead letter recorded: message %q, reason %s", letter.MessageId, letter.Reason)
+	_ = d.Ack(false)
+}
+
+// deadLetterFrom разбирает сообщение DLQ. Причину ставит воркер (x-dlq-reason) или брокер
+// при dead-lettering из notifications.queue (x-first-death-reason: expired, rejected).
+func deadLetterFrom(d amqp.Delivery) domain.DeadLetter {
+	letter := domain.DeadLetter{
+		// тело может быть не UTF-8, а колонка payload текстовая
+		Payload: strings.ReplaceAll(strings.ToValidUTF8(string(d.Body), "�"), "\x00", ""),
+	}
+	letter.Reason, _ = d.Headers[rabbitAdapter.DeadLetterReasonHeader].(string)
+	letter.Error, _ = d.Headers[rabbitAdapter.DeadLetterErrorHeader].(string)
+	if letter.Reason == "" {
+		letter.Reason, _ = d.Headers["x-first-death-reason"].(string)
+	}
+	if letter.Reason == "" {
+		letter.Reason = domain.DeadLetterRejected
+	}
+
+	var msg struct {
+		Id string `json:"id"`
+	}
+	if json.Unmarshal(d.Body, &msg) == nil {
+		letter.MessageId = msg.Id
+	}
+	return letter
+}
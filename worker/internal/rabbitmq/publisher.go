@@ -0,0 +1,88 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync"
+
+	rabbitAdapter "github.com/dontpanicw/DelayedNotifier/internal/adapter/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// publisher публикует сообщение и возвращает ошибку, если брокер его не принял
+// или не смог смаршрутизировать.
+type publisher interface {
+	Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error
+	Close() error
+}
+
+// confirmPublisher публикует с флагом mandatory в отдельном канале в режиме confirm:
+// исходную доставку воркер подтверждает (ack), только когда копия точно легла в очередь.
+type confirmPublisher struct {
+	conn *amqp.Connection
+	// mu сериализует публикации: в канале ждёт подтверждения одна публикация,
+	// поэтому basic.return относится именно к ней.
+	mu      sync.Mutex
+	ch      *amqp.Channel
+	returns chan amqp.Return
+}
+
+func newConfirmPublisher(conn *amqp.Connection) *confirmPublisher {
+	return &confirmPublisher{conn: conn}
+}
+
+func (p *confirmPublisher) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, err := p.channel()
+	if err != nil {
+		return err
+	}
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, true, false, msg)
+	if err != nil {
+		p.reset()
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		// подтверждение или return могут прийти позже и достаться следующей публикации
+		p.reset()
+		return err
+	}
+	return rabbitAdapter.ConfirmResult(acked, p.returns)
+}
+
+// channel возвращает канал публикаций, открывая его при первом обращении и после
+// закрытия. Вызывается под mu.
+func (p *confirmPublisher) channel() (*amqp.Channel, error) {
+	if p.ch != nil && !p.ch.IsClosed() {
+		return p.ch, nil
+	}
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+	p.ch = ch
+	// буфер на одно сообщение: amqp091 отдаёт return слушателю синхронно, до ack
+	p.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+	return ch, nil
+}
+
+// reset закрывает канал публикаций; следующая откроет новый. Вызывается под mu.
+func (p *confirmPublisher) reset() {
+	if p.ch != nil {
+		_ = p.ch.Close()
+		p.ch = nil
+	}
+}
+
+func (p *confirmPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reset()
+	return nil
+}
@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+// LeaseRecovery возвращает к доставке сообщения, захваченные воркером,
+// который упал или был остановлен посреди отправки.
+type LeaseRecovery struct {
+	repo     port.Repository
+	interval time.Duration
+}
+
+func NewLeaseRecovery(repo port.Repository, interval time.Duration) *LeaseRecovery {
+	return &LeaseRecovery{
+		repo:     repo,
+		interval: interval,
+	}
+}
+
+// Run проверяет захваты каждые interval до отмены ctx.
+func (l *LeaseRecovery) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := l.repo.ReleaseExpiredLeases(ctx)
+			if err != nil {
+				log.Printf("lease recovery: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("lease recovery: %d abandoned messages returned to delivery", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+// Reconciler сверяет Postgres с очередью: находит уведомления, которые всё ещё ждут
+// воркера спустя grace после срока (публикация потерялась, сообщение истекло по TTL,
+// процесс упал), и поступает с ними по политике — ставит в очередь заново,
+// помечает Lost или только сообщает о расхождении.
+type Reconciler struct {
+	repo       port.Repository
+	cache      port.StatusCache
+	recurrence port.Recurrence
+	policy     string
+	statuses   []string
+	grace      time.Duration
+	interval   time.Duration
+
+	// mu не даёт плановой сверке и запуску через admin‑эндпоинт идти одновременно.
+	mu     sync.Mutex
+	totals ReconcileTotals
+	last   *domain.ReconcileReport
+}
+
+// ReconcileTotals — счётчики сверки с запуска воркера.
+type ReconcileTotals struct {
+	Runs     int `json:"runs"`
+	Errors   int `json:"errors"`
+	Requeued int `json:"requeued"`
+	Failed   int `json:"failed"`
+	Alerted  int `json:"alerted"`
+}
+
+// ReconcileStats — состояние сверки для /debug/vars и admin‑эндпоинта.
+type ReconcileStats struct {
+	Policy string                  `json:"policy"`
+	Totals ReconcileTotals         `json:"totals"`
+	Last   *domain.ReconcileReport `json:"last,omitempty"`
+}
+
+// NewReconciler проверяет уведомления в статусах statuses — тех, в которых
+// сообщение лежит в очереди в текущем SCHEDULER_MODE.
+func NewReconciler(repo port.Repository, cache port.StatusCache, recurrence port.Recurrence, policy string, statuses []string, grace, interval time.Duration) *Reconciler {
+	return &Reconciler{
+		repo:       repo,
+		cache:      cache,
+		recurrence: recurrence,
+		policy:     policy,
+		statuses:   statuses,
+		grace:      grace,
+		interval:   interval,
+	}
+}
+
+// Run сверяет БД каждые interval до отмены ctx.
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Check(ctx)
+		}
+	}
+}
+
+// Check выполняет один проход сверки и возвращает его отчёт.
+func (r *Reconciler) Check(ctx context.Context) domain.ReconcileReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := domain.ReconcileReport{Policy: r.policy, StartedAt: time.Now(), MessageIds: []string{}}
+	overdue, err := r.apply(ctx)
+	report.FinishedAt = time.Now()
+	report.Overdue = len(overdue)
+	for _, msg := range overdue {
+		if len(report.MessageIds) == domain.ReconcileReportIds {
+			break
+		}
+		report.MessageIds = append(report.MessageIds, msg.Id)
+	}
+
+	r.totals.Runs++
+	if err != nil {
+		log.Printf("reconciler: check failed: %v", err)
+		report.Error = err.Error()
+		r.totals.Errors++
+	}
+	switch r.policy {
+	case domain.ReconcileRequeue:
+		r.totals.Requeued += len(overdue)
+	case domain.ReconcileFail:
+		r.totals.Failed += len(overdue)
+	case domain.ReconcileAlert:
+		r.totals.Alerted += len(overdue)
+	}
+	r.last = &report
+	return report
+}
+
+// apply находит просроченные уведомления и применяет к ним политику.
+func (r *Reconciler) apply(ctx context.Context) ([]domain.Message, error) {
+	switch r.policy {
+	case domain.ReconcileRequeue:
+		requeued, err := r.repo.RequeueOverdueMessages(ctx, r.statuses, r.grace)
+		for _, msg := range requeued {
+			log.Printf("reconciler: message %s scheduled at %s vanished from the queue, requeued", msg.Id, msg.ScheduledAt)
+			r.setStatus(ctx, msg.Id, domain.JobStatusScheduled)
+		}
+		return requeued, err
+	case domain.ReconcileAlert:
+		overdue, err := r.repo.ListOverdueMessages(ctx, r.statuses, r.grace)
+		if len(overdue) > 0 {
+			log.Printf("reconciler: ALERT %d messages are overdue by more than %s, first is %s scheduled at %s",
+				len(overdue), r.grace, overdue[0].Id, overdue[0].ScheduledAt)
+		}
+		return overdue, err
+	}
+
+	lost, err := r.repo.MarkLostMessages(ctx, r.statuses, r.grace)
+	for _, msg := range lost {
+		log.Printf("reconciler: message %s scheduled at %s vanished from the queue, marked lost", msg.Id, msg.ScheduledAt)
+		r.setStatus(ctx, msg.Id, domain.JobStatusLost)
+		if r.recurrence != nil && msg.ParentId != "" {
+			if err := r.recurrence.ScheduleNext(ctx, msg); err != nil {
+				log.Printf("reconciler: failed to schedule next occurrence after %s: %v", msg.Id, err)
+			}
+		}
+	}
+	return lost, err
+}
+
+func (r *Reconciler) setStatus(ctx context.Context, id, status string) {
+	if r.cache != nil {
+		_ = r.cache.SetStatus(ctx, id, status, 5*time.Minute)
+	}
+}
+
+// Stats возвращает политику, счётчики и отчёт последнего прохода.
+func (r *Reconciler) Stats() ReconcileStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return ReconcileStats{Policy: r.policy, Totals: r.totals, Last: r.last}
+}
+
+// ServeHTTP — admin‑эндпоинт сверки: GET отдаёт Stats, POST сверяет сразу и отдаёт отчёт.
+func (r *Reconciler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var res any
+	switch req.Method {
+	case http.MethodGet:
+		res = r.Stats()
+	case http.MethodPost:
+		res = r.Check(req.Context())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+// overdueRepo отдаёт одни и те же просроченные сообщения и запоминает, что с ними сделали.
+type overdueRepo struct {
+	port.Repository
+	lost     []domain.Message
+	statuses []string
+	grace    time.Duration
+	action   string
+}
+
+func (r *overdueRepo) MarkLostMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	r.statuses, r.grace, r.action = statuses, grace, domain.ReconcileFail
+	return r.lost, nil
+}
+
+func (r *overdueRepo) RequeueOverdueMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	r.statuses, r.grace, r.action = statuses, grace, domain.ReconcileRequeue
+	return r.lost, nil
+}
+
+func (r *overdueRepo) ListOverdueMessages(ctx context.Context, statuses []string, grace time.Duration) ([]domain.Message, error) {
+	r.statuses, r.grace, r.action = statuses, grace, domain.ReconcileAlert
+	return r.lost, nil
+}
+
+type recurrenceMock struct {
+	next []string
+}
+
+func (r *recurrenceMock) ScheduleNext(ctx context.Context, occurrence domain.Message) error {
+	r.next = append(r.next, occurrence.Id)
+	return nil
+}
+
+func TestReconciler_FailContinuesSeries(t *testing.T) {
+	repo := &overdueRepo{lost: []domain.Message{
+		{Id: "single"},
+		{Id: "occurrence", ParentId: "parent", Occurrence: 3},
+	}}
+	rec := &recurrenceMock{}
+	r := NewReconciler(repo, nil, rec, domain.ReconcileFail, []string{domain.JobStatusQueued}, time.Hour, time.Minute)
+
+	if report := r.Check(context.Background()); report.Overdue != 2 || repo.action != domain.ReconcileFail {
+		t.Fatalf("expected 2 messages to be marked lost, got %+v via %q", report, repo.action)
+	}
+	if len(repo.statuses) != 1 || repo.statuses[0] != domain.JobStatusQueued || repo.grace != time.Hour {
+		t.Fatalf("unexpected reconciler query: %v %s", repo.statuses, repo.grace)
+	}
+	if len(rec.next) != 1 || rec.next[0] != "occurrence" {
+		t.Fatalf("expected only the lost occurrence to advance its series, got %v", rec.next)
+	}
+}
+
+func TestReconciler_PolicyAndReport(t *testing.T) {
+	for _, policy := range []string{domain.ReconcileRequeue, domain.ReconcileAlert} {
+		repo := &overdueRepo{lost: []domain.Message{{Id: "m1", ParentId: "parent"}}}
+		rec := &recurrenceMock{}
+		r := NewReconciler(repo, nil, rec, policy, []string{domain.JobStatusScheduled}, time.Hour, time.Minute)
+
+		// admin‑эндпоинт запускает сверку сразу
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/reconciler", nil))
+		var report domain.ReconcileReport
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		if repo.action != policy || report.Policy != policy || report.Overdue != 1 || report.MessageIds[0] != "m1" {
+			t.Fatalf("%s: unexpected report %+v via %q", policy, report, repo.action)
+		}
+		// серия продолжается, только когда вхождение помечено Lost
+		if len(rec.next) != 0 {
+			t.Fatalf("%s: series must not advance, got %v", policy, rec.next)
+		}
+
+		r.Check(context.Background())
+		stats := r.Stats()
+		if stats.Totals.Runs != 2 || stats.Totals.Requeued+stats.Totals.Alerted != 2 || stats.Totals.Failed != 0 {
+			t.Fatalf("%s: unexpected totals %+v", policy, stats.Totals)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+// Scheduler периодически забирает из БД наступившие уведомления и публикует их
+// в очередь для немедленной доставки. Ожидание срока не занимает ни памяти воркера,
+// ни неподтверждённых сообщений в RabbitMQ, а SKIP LOCKED в репозитории позволяет
+// запускать несколько реплик воркера одновременно.
+type Scheduler struct {
+	name     string
+	source   source
+	queue    port.MessageQueue
+	interval time.Duration
+	batch    int
+}
+
+// source передаёт в dispatch пачку сообщений, готовых к публикации, и фиксирует переданные.
+type source func(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error)
+
+func NewScheduler(repo port.Repository, queue port.MessageQueue, interval time.Duration, batch int) *Scheduler {
+	return &Scheduler{
+		name:     "scheduler",
+		source:   repo.DispatchDueMessages,
+		queue:    queue,
+		interval: interval,
+		batch:    batch,
+	}
+}
+
+// NewOutboxRelay публикует сообщения из outbox, записанные вместе с ними
+// в одной транзакции (режимы broker и timer). Цикл опроса тот же, что у планировщика.
+func NewOutboxRelay(repo port.Repository, queue port.MessageQueue, interval time.Duration, batch int) *Scheduler {
+	return &Scheduler{
+		name:     "outbox relay",
+		source:   repo.DispatchOutbox,
+		queue:    queue,
+		interval: interval,
+		batch:    batch,
+	}
+}
+
+// Run опрашивает БД каждые interval до отмены ctx.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll публикует сообщения пачками, пока пачки заполняются целиком.
+func (s *Scheduler) Poll(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := s.source(ctx, s.batch, s.queue.SendMessage)
+		if n > 0 {
+			log.Printf("%s: %d messages queued", s.name, n)
+		}
+		if err != nil {
+			log.Printf("%s: dispatch failed: %v", s.name, err)
+			return
+		}
+		if n < s.batch {
+			return
+		}
+	}
+}
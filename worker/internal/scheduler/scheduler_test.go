@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dontpanicw/DelayedNotifier/internal/domain"
+	"github.com/dontpanicw/DelayedNotifier/internal/port"
+)
+
+// dueRepo отдаёт наступившие сообщения пачками, как DispatchDueMessages в Postgres.
+type dueRepo struct {
+	port.Repository
+	due   []domain.Message
+	calls int
+}
+
+func (r *dueRepo) DispatchDueMessages(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error) {
+	r.calls++
+	n := 0
+	for len(r.due) > 0 && n < limit {
+		if err := dispatch(ctx, r.due[0]); err != nil {
+			return n, err
+		}
+		r.due = r.due[1:]
+		n++
+	}
+	return n, nil
+}
+
+type queueMock struct {
+	sent   []domain.Message
+	failAt int
+}
+
+func (q *queueMock) SendMessage(ctx context.Context, message domain.Message) error {
+	if q.failAt > 0 && len(q.sent) == q.failAt {
+		return errors.New("publish failed")
+	}
+	q.sent = append(q.sent, message)
+	return nil
+}
+
+func dueMessages(n int) []domain.Message {
+	res := make([]domain.Message, n)
+	for i := range res {
+		res[i] = domain.Message{Id: string(rune('a' + i)), Status: domain.JobStatusScheduled}
+	}
+	return res
+}
+
+func TestPoll_DrainsFullBatches(t *testing.T) {
+	repo := &dueRepo{due: dueMessages(5)}
+	q := &queueMock{}
+
+	NewScheduler(repo, q, time.Second, 2).Poll(context.Background())
+
+	if len(q.sent) != 5 || len(repo.due) != 0 {
+		t.Fatalf("expected all 5 due messages to be queued, got %d", len(q.sent))
+	}
+	if repo.calls != 3 {
+		t.Fatalf("expected 3 batches (2+2+1), got %d", repo.calls)
+	}
+}
+
+func TestPoll_StopsOnPublishError(t *testing.T) {
+	repo := &dueRepo{due: dueMessages(5)}
+	q := &queueMock{failAt: 1}
+
+	NewScheduler(repo, q, time.Second, 2).Poll(context.Background())
+
+	if len(q.sent) != 1 || len(repo.due) != 4 {
+		t.Fatalf("expected unpublished messages to stay due, got sent=%d due=%d", len(q.sent), len(repo.due))
+	}
+	if repo.calls != 1 {
+		t.Fatalf("expected polling to stop until the next tick, got %d calls", repo.calls)
+	}
+}
+
+// outboxRepo отдаёт сообщения только через DispatchOutbox.
+type outboxRepo struct {
+	port.Repository
+	pending []domain.Message
+}
+
+func (r *outboxRepo) DispatchOutbox(ctx context.Context, limit int, dispatch func(context.Context, domain.Message) error) (int, error) {
+	n := 0
+	for len(r.pending) > 0 && n < limit {
+		if err := dispatch(ctx, r.pending[0]); err != nil {
+			return n, err
+		}
+		r.pending = r.pending[1:]
+		n++
+	}
+	return n, nil
+}
+
+func TestOutboxRelay_PublishesPending(t *testing.T) {
+	repo := &outboxRepo{pending: dueMessages(3)}
+	q := &queueMock{}
+
+	NewOutboxRelay(repo, q, time.Second, 10).Poll(context.Background())
+
+	if len(q.sent) != 3 || len(repo.pending) != 0 {
+		t.Fatalf("expected all outbox messages to be published, got %d", len(q.sent))
+	}
+}